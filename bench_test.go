@@ -1,7 +1,10 @@
 package cors
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/valyala/fasthttp"
@@ -97,3 +100,295 @@ func BenchmarkPreflightHeader(b *testing.B) {
 		handler(&ctx)
 	}
 }
+
+// The benchmarks above replay the same request without resetting the response, the
+// ones below reset it as a server would, and send the preflights as browsers do
+
+func BenchmarkActualRequest(b *testing.B) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodGet)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "somedomain.com")
+
+	handler := Default().Handler(testHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Response.Reset()
+		handler(&ctx)
+	}
+}
+
+func BenchmarkActualRequestAllowedOrigin(b *testing.B) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodGet)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "somedomain.com")
+
+	handler := New(Options{
+		AllowedOrigins: []string{"somedomain.com"},
+	}).Handler(testHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Response.Reset()
+		handler(&ctx)
+	}
+}
+
+func BenchmarkPreflightRequest(b *testing.B) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodOptions)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "somedomain.com")
+	ctx.Request.Header.Add("Access-Control-Request-Method", "GET")
+
+	handler := Default().Handler(testHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Response.Reset()
+		handler(&ctx)
+	}
+}
+
+func BenchmarkPreflightRequestHeader(b *testing.B) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodOptions)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "somedomain.com")
+	ctx.Request.Header.Add("Access-Control-Request-Method", "GET")
+	ctx.Request.Header.Add("Access-Control-Request-Headers", "Accept")
+
+	handler := Default().Handler(testHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Response.Reset()
+		handler(&ctx)
+	}
+}
+
+func BenchmarkPreflightHeaderCached(b *testing.B) {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodOptions)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "somedomain.com")
+	ctx.Request.Header.Add("Access-Control-Request-Method", "GET")
+	ctx.Request.Header.Add("Access-Control-Request-Headers", "Accept")
+
+	handler := New(Options{PreflightCacheSize: 100}).Handler(testHandler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Response.Reset()
+		handler(&ctx)
+	}
+}
+
+func BenchmarkPreflightHeaders(b *testing.B) {
+	for _, n := range []int{1, 10, 50} {
+		var allowed, requested []string
+		for i := 0; i < n; i++ {
+			allowed = append(allowed, fmt.Sprintf("X-Header-%d", i))
+			requested = append(requested, fmt.Sprintf("x-header-%d", i))
+		}
+
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod(http.MethodOptions)
+			ctx.Request.SetRequestURI("http://example.com/foo")
+			ctx.Request.Header.Add("Origin", "somedomain.com")
+			ctx.Request.Header.Add("Access-Control-Request-Method", "GET")
+			ctx.Request.Header.Add("Access-Control-Request-Headers", strings.Join(requested, ", "))
+
+			handler := New(Options{AllowedHeaders: allowed}).Handler(testHandler)
+			cached := New(Options{AllowedHeaders: allowed, PreflightCacheSize: 100}).Handler(testHandler)
+
+			b.Run("uncached", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					ctx.Response.Reset()
+					handler(&ctx)
+				}
+			})
+			b.Run("cached", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					ctx.Response.Reset()
+					cached(&ctx)
+				}
+			})
+		})
+	}
+}
+
+// request returns a func serving ctx with handler, as a server would
+func request(handler fasthttp.RequestHandler, ctx *fasthttp.RequestCtx) func() {
+	return func() {
+		ctx.Response.Reset()
+		handler(ctx)
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	// The race detector allocates
+	if raceEnabled {
+		t.Skip("allocations aren't checked with the race detector")
+	}
+
+	isolation := IsolatedAppPolicy()
+	isolation.ResourcePolicy = "same-site"
+	cidr, _ := CIDROrigin("192.168.0.0/16")
+	site, _ := SiteOrigin("example.co.uk")
+	cidrOrigin := []byte("http://192.168.1.20:3000")
+	siteOrigin, siteOriginUpper := []byte("https://www.example.co.uk"), []byte("https://WWW.Example.co.uk")
+	var vary fasthttp.ResponseHeader
+	fetch := actualCtx("http://foobar.com")
+	fetch.Request.Header.Set("Sec-Fetch-Site", "cross-site")
+	fetch.Request.Header.Set("Sec-Fetch-Mode", "cors")
+
+	cases := []struct {
+		name string
+		f    func()
+	}{
+		{"Default", request(New(Options{}).Handler(testHandler), actualCtx("http://foobar.com"))},
+		{"AllowedOrigin", request(New(Options{AllowedOrigins: []string{"http://foobar.com"}}).Handler(testHandler), actualCtx("http://FOOBAR.com"))},
+		{"WildcardOrigin", request(New(Options{AllowedOrigins: []string{"http://*.bar.com"}}).Handler(testHandler), actualCtx("http://foo.bar.com"))},
+		{"DisallowedOrigin", request(New(Options{AllowedOrigins: []string{"http://foobar.com"}}).Handler(testHandler), actualCtx("http://barbaz.com"))},
+		{"Strict", request(New(Options{AllowedOrigins: []string{"http://foobar.com"}, Strict: true}).Handler(testHandler), actualCtx("http://foobar.com"))},
+		{
+			"ExposedHeaders",
+			request(New(Options{
+				AllowedOrigins:   []string{"http://foobar.com"},
+				ExposedHeaders:   []string{"X-Header-1", "X-Header-2"},
+				AllowCredentials: true,
+			}).Handler(testHandler), actualCtx("http://foobar.com")),
+		},
+		{
+			"ExposeMode",
+			request(New(Options{
+				ExposedHeaders: []string{"X-Static"},
+				ExposeMode:     ExposeNonSafelisted,
+			}).Handler(rateLimitedHandler), actualCtx("http://foobar.com")),
+		},
+		{
+			"ReapplyAfterHandler",
+			request(New(Options{
+				AllowedOrigins:      []string{"http://foobar.com"},
+				ExposedHeaders:      []string{"X-Reset"},
+				AllowCredentials:    true,
+				ReapplyAfterHandler: true,
+			}).Handler(resetHandler), actualCtx("http://foobar.com")),
+		},
+		{"Preflight", request(New(Options{}).Handler(testHandler), preflightCtx("http://foobar.com", "get", ""))},
+		{"PreflightDefaultHeaders", request(New(Options{}).Handler(testHandler), preflightCtx("http://foobar.com", "get", "accept, content-type, x-requested-with"))},
+		{
+			"PreflightAllowedHeaders",
+			request(New(Options{AllowedHeaders: []string{"X-Header-1", "X-Header-2"}, MaxAge: 10}).Handler(testHandler),
+				preflightCtx("http://foobar.com", "get", "X-HEADER-2, x-header-1")),
+		},
+		{
+			"PreflightDisallowedHeaders",
+			request(New(Options{AllowedHeaders: []string{"X-Header-1"}}).Handler(testHandler),
+				preflightCtx("http://foobar.com", "get", "X-Header-2")),
+		},
+		{
+			"PreflightWildcardHeaders",
+			request(New(Options{AllowedHeaders: []string{"*"}, AllowedMethods: []string{"*"}}).Handler(testHandler),
+				preflightCtx("http://foobar.com", "get", "X-Header-1, Authorization")),
+		},
+		{
+			"PreflightCredentials",
+			request(New(Options{AllowedHeaders: []string{"*"}, AllowCredentials: true}).Handler(testHandler),
+				preflightCtx("http://foobar.com", "get", "X-Header-1, X-Header-2")),
+		},
+		{
+			"PreflightStrict",
+			request(New(Options{AllowedMethods: []string{"get"}, Strict: true}).Handler(testHandler),
+				preflightCtx("http://foobar.com", "get", "Accept")),
+		},
+		{
+			"PreflightCache",
+			request(New(Options{
+				AllowedHeaders:     []string{"X-Header-1", "X-Header-2"},
+				PreflightCacheSize: 10,
+			}).Handler(testHandler), preflightCtx("http://foobar.com", "GET", "X-Header-1, X-Header-2")),
+		},
+		{
+			"PreflightExtras",
+			request(New(Options{
+				AllowedOrigins:           []string{"http://foobar.com"},
+				AllowedMethods:           []string{"GET", "PUT"},
+				MaxAge:                   10,
+				PreflightCacheControl:    true,
+				PreflightCDNCacheControl: true,
+				PreflightSurrogateKey:    "cors preflight",
+				PreflightAllowHeader:     true,
+			}).Handler(testHandler), preflightCtx("http://foobar.com", "PUT", "")),
+		},
+		{
+			"Isolation",
+			request(New(Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				Isolation:      &isolation,
+			}).Handler(testHandler), actualCtx("http://foobar.com")),
+		},
+		{
+			"ResourceIsolation",
+			request(New(Options{
+				AllowedOrigins:    []string{"http://foobar.com"},
+				ResourceIsolation: true,
+			}).Handler(testHandler), fetch),
+		},
+		{
+			"CSRFGuard",
+			request(New(Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				CSRFGuard:      true,
+				TrustedProxies: []string{"10.0.0.0/8"},
+			}).Handler(testHandler), remoteCtx("POST", "http://backend/foo", "10.0.0.1", map[string]string{
+				"Referer":           "https://example.com/form",
+				"X-Forwarded-Host":  "evil.com, example.com",
+				"X-Forwarded-Proto": "https",
+			})),
+		},
+		{
+			"ForwardedSameOrigin",
+			request(New(Options{
+				AllowOriginRequestFunc: func(ctx *fasthttp.RequestCtx, origin []byte) bool {
+					return false
+				},
+				CSRFGuard:      true,
+				SkipSameOrigin: true,
+				TrustedProxies: []string{"10.0.0.0/8"},
+				ProxyHeaders:   ProxyForwarded,
+			}).Handler(testHandler), remoteCtx("POST", "http://backend:8080/foo", "10.0.0.1", map[string]string{
+				"Origin":    "https://example.com",
+				"Forwarded": `for=192.0.2.60;proto=https;host=example.com, for="10.0.0.2:5000"`,
+			})),
+		},
+		{"CIDROrigin", func() { cidr.Match(cidrOrigin) }},
+		{"SiteOrigin", func() { site.Match(siteOrigin) }},
+		{"SiteOriginUpper", func() { site.Match(siteOriginUpper) }},
+		{
+			"AddVary",
+			func() {
+				vary.Reset()
+				vary.Add("Vary", "Accept-Encoding")
+				vary.Add("Vary", "Cookie")
+				addVary(&vary, varyPreflight)
+			},
+		},
+	}
+	for _, tc := range cases {
+		if allocs := testing.AllocsPerRun(100, tc.f); allocs != 0 {
+			t.Errorf("%s: got %v allocs per run, want 0", tc.name, allocs)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cors
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// maxPreflightCacheKeyLength caps the size of the keys of the preflight cache, so a
+// client can't use it to pin large amounts of memory. Longer preflights are simply
+// not cached.
+const maxPreflightCacheKeyLength = 2048
+
+// headerWriter is implemented by *fasthttp.ResponseHeader and by preflight cache
+// entries, which record the rendered headers.
+type headerWriter interface {
+	Add(key, value string)
+	SetBytesV(key string, value []byte)
+}
+
+// cachedHeader is a header recorded by a preflight cache entry
+type cachedHeader struct {
+	key   string
+	value []byte
+	add   bool
+}
+
+// preflightCacheEntry holds a fully rendered preflight response
+type preflightCacheEntry struct {
+	key     string
+	allowed bool
+	headers []cachedHeader
+}
+
+// Add records a header added to the response
+func (e *preflightCacheEntry) Add(key, value string) {
+	e.headers = append(e.headers, cachedHeader{key, []byte(value), true})
+}
+
+// SetBytesV records a header set on the response. The value is copied, as it usually
+// points to request or pooled memory.
+func (e *preflightCacheEntry) SetBytesV(key string, value []byte) {
+	e.headers = append(e.headers, cachedHeader{key, append([]byte(nil), value...), false})
+}
+
+// writeTo replays the recorded headers on the response
+func (e *preflightCacheEntry) writeTo(headers *fasthttp.ResponseHeader) {
+	for _, h := range e.headers {
+		if h.add {
+			headers.AddBytesV(h.key, h.value)
+		} else {
+			headers.SetBytesV(h.key, h.value)
+		}
+	}
+}
+
+// preflightCache is a bounded LRU cache of rendered preflight responses
+type preflightCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+func newPreflightCache(size int) *preflightCache {
+	return &preflightCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+// get returns the entry cached for key, or nil
+func (pc *preflightCache) get(key []byte) *preflightCacheEntry {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	el, ok := pc.entries[string(key)]
+	if !ok {
+		return nil
+	}
+	pc.lru.MoveToFront(el)
+	return el.Value.(*preflightCacheEntry)
+}
+
+// put caches e under key, evicting the least recently used entry when full
+func (pc *preflightCache) put(key []byte, e *preflightCacheEntry) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if el, ok := pc.entries[string(key)]; ok {
+		// Another request rendered the same preflight concurrently
+		pc.lru.MoveToFront(el)
+		return
+	}
+	if pc.lru.Len() >= pc.size {
+		oldest := pc.lru.Back()
+		pc.lru.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*preflightCacheEntry).key)
+	}
+	e.key = string(key)
+	pc.entries[e.key] = pc.lru.PushFront(e)
+}
+
+// reset drops all the cached entries
+func (pc *preflightCache) reset() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.entries = make(map[string]*list.Element, pc.size)
+	pc.lru.Init()
+}
+
+// len returns the number of cached entries
+func (pc *preflightCache) len() int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	return pc.lru.Len()
+}
+
+// appendPreflightCacheKey appends the cache key of a preflight request to dst: the
+// origin, the requested method and all the requested headers lines, as sent. Each part
+// is prefixed by its length so distinct requests can never share a key.
+func appendPreflightCacheKey(dst []byte, ctx *fasthttp.RequestCtx) []byte {
+	dst = appendCacheKeyPart(dst, ctx.Request.Header.Peek("Origin"))
+	dst = appendCacheKeyPart(dst, ctx.Request.Header.Peek("Access-Control-Request-Method"))
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		if equalFoldString(key, "Access-Control-Request-Headers") {
+			dst = appendCacheKeyPart(dst, value)
+		}
+	})
+	return dst
+}
+
+func appendCacheKeyPart(dst, part []byte) []byte {
+	dst = strconv.AppendInt(dst, int64(len(part)), 10)
+	dst = append(dst, ':')
+	return append(dst, part...)
+}
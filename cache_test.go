@@ -0,0 +1,140 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func preflightCtx(origin, method, headers string) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodOptions)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", origin)
+	ctx.Request.Header.Add("Access-Control-Request-Method", method)
+	if headers != "" {
+		ctx.Request.Header.Add("Access-Control-Request-Headers", headers)
+	}
+	return &ctx
+}
+
+func TestPreflightCache(t *testing.T) {
+	options := Options{
+		AllowedOrigins:   []string{"http://foobar.com"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"X-Header-1", "X-Header-2"},
+		AllowCredentials: true,
+		MaxAge:           10,
+	}
+	uncached := New(options).Handler(testHandler)
+	options.PreflightCacheSize = 10
+	c := New(options)
+	cached := c.Handler(testHandler)
+
+	requests := []struct {
+		origin  string
+		method  string
+		headers string
+	}{
+		{"http://foobar.com", "PUT", "x-header-1, X-HEADER-2"},
+		{"http://foobar.com", "GET", ""},
+		{"http://foobar.com", "DELETE", ""},
+		{"http://barbaz.com", "GET", ""},
+		{"http://foobar.com", "GET", "X-Header-3"},
+		{"http://foobar.com", "GET", "X-Foo@Bar"},
+	}
+	for _, r := range requests {
+		want := preflightCtx(r.origin, r.method, r.headers)
+		uncached(want)
+		expected := map[string]string{}
+		for _, name := range allHeaders {
+			expected[name] = joinHeaderValues(want, name)
+		}
+
+		// First request renders and caches the response, the second one is served
+		// from the cache
+		for i := 0; i < 2; i++ {
+			got := preflightCtx(r.origin, r.method, r.headers)
+			cached(got)
+			assertHeaders(t, got, expected)
+			if got.Response.StatusCode() != want.Response.StatusCode() {
+				t.Errorf("status = %d, want %d", got.Response.StatusCode(), want.Response.StatusCode())
+			}
+		}
+	}
+	if n := c.preflightCache.len(); n != len(requests) {
+		t.Errorf("got %d cached preflights, want %d", n, len(requests))
+	}
+}
+
+func TestPreflightCacheEviction(t *testing.T) {
+	c := New(Options{PreflightCacheSize: 2})
+	handler := c.Handler(testHandler)
+
+	handler(preflightCtx("http://a.com", "GET", ""))
+	handler(preflightCtx("http://b.com", "GET", ""))
+	// Touch a.com so b.com is the least recently used
+	handler(preflightCtx("http://a.com", "GET", ""))
+	handler(preflightCtx("http://c.com", "GET", ""))
+
+	if n := c.preflightCache.len(); n != 2 {
+		t.Errorf("got %d cached preflights, want 2", n)
+	}
+	for origin, cached := range map[string]bool{"http://a.com": true, "http://b.com": false, "http://c.com": true} {
+		key := appendPreflightCacheKey(nil, preflightCtx(origin, "GET", ""))
+		if got := c.preflightCache.get(key) != nil; got != cached {
+			t.Errorf("%s cached = %v, want %v", origin, got, cached)
+		}
+	}
+}
+
+func TestPreflightCacheInvalidation(t *testing.T) {
+	allowed := "http://foobar.com"
+	c := New(Options{
+		AllowOriginFunc: func(origin []byte) bool {
+			return string(origin) == allowed
+		},
+		PreflightCacheSize: 10,
+	})
+	handler := c.Handler(testHandler)
+
+	ctx := preflightCtx("http://foobar.com", "GET", "")
+	handler(ctx)
+	if got := joinHeaderValues(ctx, "Access-Control-Allow-Origin"); got != "http://foobar.com" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, "http://foobar.com")
+	}
+
+	allowed = "http://barbaz.com"
+	c.InvalidatePreflightCache()
+
+	ctx = preflightCtx("http://foobar.com", "GET", "")
+	handler(ctx)
+	if got := joinHeaderValues(ctx, "Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
+
+func TestPreflightCacheDisabledWithRequestFunc(t *testing.T) {
+	c := New(Options{
+		AllowOriginRequestFunc: func(ctx *fasthttp.RequestCtx, origin []byte) bool {
+			return true
+		},
+		PreflightCacheSize: 10,
+	})
+	if c.preflightCache != nil {
+		t.Error("preflight cache should be disabled when AllowOriginRequestFunc is set")
+	}
+}
+
+func TestPreflightCacheKey(t *testing.T) {
+	one := preflightCtx("http://foobar.com", "GET", "")
+	one.Request.Header.Add("Access-Control-Request-Headers", "a")
+	one.Request.Header.Add("Access-Control-Request-Headers", "b")
+
+	two := preflightCtx("http://foobar.com", "GET", "a\x001:b")
+
+	if string(appendPreflightCacheKey(nil, one)) == string(appendPreflightCacheKey(nil, two)) {
+		t.Error("distinct preflights should not share a cache key")
+	}
+}
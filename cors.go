@@ -21,53 +21,217 @@ The resulting handler is a standard net/http handler.
 package cors
 
 import (
-	"bytes"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
+	"runtime/debug"
 	"strings"
 
 	"github.com/valyala/fasthttp"
 )
 
+// Constant header values, shared to avoid allocating them on every request
+var (
+	headerTrue     = []byte("true")
+	headerWildcard = []byte("*")
+	headerZero     = []byte("0")
+	headerNoStore  = []byte("no-store")
+
+	headerWildcardAuthorization = []byte("*, Authorization")
+)
+
 // Options is a configuration container to setup the CORS middleware.
 type Options struct {
 	// AllowedOrigins is a list of origins a cross-domain request can be executed from.
 	// If the special "*" value is present in the list, all origins will be allowed.
 	// An origin may contain a wildcard (*) to replace 0 or more characters
 	// (i.e.: http://*.domain.com). Usage of wildcards implies a small performance penalty.
-	// Only one wildcard can be used per origin.
+	// Only one wildcard can be used per origin. Neither "*" nor the default value match
+	// the "null" origin, see AllowNullOrigin.
+	// An entry prefixed with "site:" matches a registrable domain and all its
+	// subdomains, using an embedded snapshot of the Public Suffix List (i.e.:
+	// site:example.co.uk, or site:https://example.co.uk for https only). See SiteOrigin.
 	// Default value is ["*"]
 	AllowedOrigins []string
+	// DeniedOrigins is a list of origins that are never allowed, using the same syntax
+	// as AllowedOrigins. It is checked before any other origin option, including "*",
+	// OriginRules and the custom origin functions.
+	DeniedOrigins []string
 	// AllowOriginFunc is a custom function to validate the origin. It take the origin
 	// as argument and returns true if allowed or false otherwise. If this option is
 	// set, the content of AllowedOrigins is ignored.
 	AllowOriginFunc func(origin []byte) bool
 	// AllowOriginRequestFunc is a custom function to validate the origin. It takes the HTTP Request object and the origin as
 	// argument and returns true if allowed or false otherwise. If this option is set, the content of `AllowedOrigins`
-	// and `AllowOriginFunc` is ignored.
+	// and `AllowOriginFunc` is ignored. Call Cors.RequestSchemeHost from the function to
+	// get the scheme and host the request was sent to, as seen through the TrustedProxies.
 	AllowOriginRequestFunc func(ctx *fasthttp.RequestCtx, origin []byte) bool
+	// OriginMatcher is a custom matcher of the allowed origins, see Any, All and Not to
+	// compose the built-in matchers. If this option is set, the content of
+	// AllowedOrigins is ignored.
+	OriginMatcher OriginMatcher
+	// OriginRules is an ordered list of allow/deny rules evaluated before any other
+	// origin option, firewall-style: the first rule matching the request decides. When
+	// no rule matches, AllowOriginRequestFunc, AllowOriginFunc and AllowedOrigins are
+	// used as usual, except that AllowedOrigins no longer defaults to all origins.
+	OriginRules []OriginRule
+	// AllowNullOrigin allows the opaque "null" origin, sent by sandboxed iframes, pages
+	// loaded from file: URLs and some redirects. As any document can end up with a null
+	// origin, it is only allowed when opted in, even when all origins are allowed, by
+	// AllowedOrigins or by OriginRules. It is checked before OriginRules, so only
+	// DeniedOrigins can deny it then.
+	AllowNullOrigin bool
+	// AllowedExtensions lists the browser extensions allowed, as IDs indexed by origin
+	// scheme, i.e.: {"chrome-extension": {"<id>"}, "moz-extension": {"<uuid>"}}.
+	// Extension IDs are matched exactly. Other non-web origins, such as the
+	// capacitor://localhost origin of Capacitor apps, can be listed in AllowedOrigins.
+	AllowedExtensions map[string][]string
+	// AllowLoopback allows the http and https origins of the loopback interface on any
+	// port: localhost and its subdomains, 127.0.0.0/8 and [::1]. It is meant for
+	// development, where frontends run on ever changing ports, and is checked after
+	// DeniedOrigins and OriginRules, in addition to the other origin options.
+	AllowLoopback bool
+	// AllowedOriginCIDRs is a list of IP ranges in CIDR notation (i.e.: 192.168.0.0/16
+	// or fd00::/8) whose http and https origins are allowed on any port. Origins using a
+	// host name are never matched. Like AllowLoopback, it is checked in addition to the
+	// other origin options.
+	AllowedOriginCIDRs []string
+	// AllowPrivateNetworkCredentials must be set to combine AllowLoopback or
+	// AllowedOriginCIDRs with AllowCredentials, or with OriginPolicies allowing
+	// credentials, in strict mode, acknowledging that any page served from those hosts
+	// can read credentialed responses.
+	AllowPrivateNetworkCredentials bool
 	// AllowedMethods is a list of methods the client is allowed to use with
 	// cross-domain requests. Default value is simple methods (HEAD, GET and POST).
+	// If the special "*" value is present in the list, all methods will be allowed.
+	// Browsers only honor a literal "*" for requests without credentials, so when
+	// AllowCredentials is set the requested method is echoed instead.
 	AllowedMethods []string
 	// AllowedHeaders is list of non simple headers the client is allowed to use with
 	// cross-domain requests.
 	// If the special "*" value is present in the list, all headers will be allowed.
+	// A literal "*" is only sent when AllowCredentials is false, otherwise the
+	// requested headers are echoed. Note that "*" never covers Authorization, so
+	// it is always listed explicitly when requested.
 	// Default value is [] but "Origin" is always appended to the list.
 	AllowedHeaders []string
 	// ExposedHeaders indicates which headers are safe to expose to the API of a CORS
-	// API specification
+	// API specification.
+	// If the special "*" value is present in the list, all headers are exposed to
+	// requests without credentials. When AllowCredentials is set, only the other
+	// headers of the list are exposed.
 	ExposedHeaders []string
+	// ReapplyAfterHandler writes the CORS headers of actual requests again once the
+	// handler returned, so they survive a ctx.Response.Reset. The headers the handler
+	// wrote itself are kept.
+	ReapplyAfterHandler bool
+	// RecoverPanics recovers the panics of the handler on actual requests, replying with
+	// a 500 Internal Server Error carrying the CORS headers, so that browsers report
+	// the error rather than a CORS failure. The panic is then logged, or propagated
+	// when Repanic is set.
+	RecoverPanics bool
+	// Repanic propagates the panics recovered with RecoverPanics once the error response
+	// is written, for an outer middleware to handle them.
+	Repanic bool
+	// ExposeMode selects how the exposed headers are computed. With any mode but the
+	// default ExposeStatic, the CORS headers of actual requests are written once the
+	// handler returned, keeping the ones it already wrote, so that the headers it sets
+	// can be exposed.
+	ExposeMode ExposeMode
+	// ExposedHeaderPrefixes lists the prefixes of the response headers exposed with
+	// ExposePrefixes, i.e.: "X-RateLimit-". Matching ignores case.
+	ExposedHeaderPrefixes []string
+	// ExposeHeadersFunc returns the headers to expose with ExposeCallback. It is
+	// called once the handler returned, with the final response.
+	ExposeHeadersFunc func(ctx *fasthttp.RequestCtx) []string
+	// TimingAllowOrigin adds Timing-Allow-Origin to the responses of actual requests
+	// from allowed origins, with the value of Access-Control-Allow-Origin, so they can
+	// read the Resource Timing details of the response. Requests without Origin, such as
+	// the no-cors loads of images and scripts, get "*" when all origins are allowed, the
+	// exact origins of AllowedOrigins otherwise.
+	TimingAllowOrigin bool
+	// Isolation adds the cross-origin isolation headers of the policy to the responses
+	// of actual requests, cross-origin or not. Its ResourcePolicy can't be same-origin,
+	// which would block the no-cors loads of the allowed origins, including the default
+	// "*"; use IsolationPolicy.Handler for resources only loaded by their own origin.
+	Isolation *IsolationPolicy
+	// ResourceIsolation rejects the cross-site requests that aren't navigations and
+	// don't come from an allowed origin, using the Sec-Fetch-Site, Sec-Fetch-Mode and
+	// Sec-Fetch-Dest headers. Requests without Fetch Metadata are rejected when their
+	// Origin is neither same-origin nor allowed. Origins only allowed by a "*" in
+	// AllowedOrigins, such as with the default AllowedOrigins, are rejected.
+	ResourceIsolation bool
+	// CSRFGuard rejects the requests using unsafe methods, such as POST, unless their
+	// Origin, or the origin of their Referer when Origin is missing, is same-origin or
+	// allowed. Requests with neither header are rejected, and so are the origins only
+	// allowed by a "*" in AllowedOrigins, such as with the default AllowedOrigins.
+	CSRFGuard bool
+	// RejectHandler writes the response of the requests rejected by ResourceIsolation or
+	// CSRFGuard. The default replies with 403 Forbidden.
+	RejectHandler fasthttp.RequestHandler
+	// TrustedProxies lists the IP addresses and ranges, in CIDR notation, of the proxies
+	// whose forwarded headers give the scheme and host the client sent the request to,
+	// for the same-origin checks and Cors.RequestSchemeHost.
+	TrustedProxies []string
+	// ProxyHeaders selects the forwarded headers read from TrustedProxies, the default
+	// is ProxyXForwarded.
+	ProxyHeaders ProxyHeaders
+	// SkipSameOrigin doesn't add CORS headers to the responses of same-origin requests,
+	// which browsers send with an Origin header for methods other than GET and HEAD.
+	// The origin of the request is given by the Host header, or by the forwarded headers
+	// of TrustedProxies.
+	SkipSameOrigin bool
 	// MaxAge indicates how long (in seconds) the results of a preflight request
 	// can be cached
 	MaxAge int
 	// AllowCredentials indicates whether the request can include user credentials like
 	// cookies, HTTP authentication or client side SSL certificates.
 	AllowCredentials bool
+	// OriginPolicies overrides the AllowedMethods, AllowedHeaders, ExposedHeaders,
+	// AllowCredentials and MaxAge options for the origins matching a pattern, using the
+	// AllowedOrigins syntax. Unset fields keep the global value. Policies don't allow
+	// origins, they only change the response to the origins allowed by the other
+	// options. When several patterns match an origin, exact origins take precedence over
+	// wildcards and sites, then longer patterns over shorter ones.
+	OriginPolicies map[string]OriginPolicy
 	// OptionsPassthrough instructs preflight to let other potential next handlers to
 	// process the OPTIONS method. Turn this on if your application handles OPTIONS.
 	OptionsPassthrough bool
+	// OptionsPassthroughRejected lets the next handler process the preflights that were
+	// rejected, such as the ones from disallowed origins, so an application handling
+	// OPTIONS can take over. Successful preflights are still answered directly.
+	OptionsPassthroughRejected bool
+	// PreflightSuccessStatus is the status code of successful preflight responses. It
+	// must be a 2xx status, the default is 204 No Content. Some old clients require 200.
+	PreflightSuccessStatus int
+	// PreflightFailureStatus is the status code of rejected preflight responses, the
+	// default is PreflightSuccessStatus. Browsers fail preflights without CORS headers
+	// whatever their status, so this only helps clients and logs tell rejections apart.
+	PreflightFailureStatus int
+	// Strict enables the case-sensitive matching required by the spec: origins are
+	// compared byte for byte, malformed Origin values are rejected, and methods
+	// are matched case-sensitively, only normalizing the methods the Fetch spec
+	// normalizes (DELETE, GET, HEAD, OPTIONS, POST and PUT).
+	Strict bool
+	// PreflightCacheSize is the maximum number of rendered preflight responses kept in
+	// memory, indexed by origin, requested method and requested headers. Caching is
+	// disabled when zero, or when the response depends on the whole request through
+	// AllowOriginRequestFunc or OriginRules with path or host conditions. Call
+	// Cors.InvalidatePreflightCache whenever the result of AllowOriginFunc changes.
+	PreflightCacheSize int
+	// PreflightCacheControl sets Cache-Control on preflight responses, so that CDNs and
+	// proxies don't cache them longer than browsers: max-age matching MaxAge for
+	// successful preflights, no-store otherwise.
+	PreflightCacheControl bool
+	// PreflightCDNCacheControl also sets the Cache-Control value of preflight responses
+	// as CDN-Cache-Control, for CDNs honoring RFC 9213.
+	PreflightCDNCacheControl bool
+	// PreflightSurrogateKey is set as the Surrogate-Key header of preflight responses,
+	// so a CDN can purge them at once when the policy changes.
+	PreflightSurrogateKey string
+	// PreflightAllowHeader adds an Allow header listing the allowed methods and an
+	// explicit Content-Length: 0 to preflight responses.
+	PreflightAllowHeader bool
 	// Debugging flag adds additional output to debug server side CORS issues
 	Debug bool
 }
@@ -81,38 +245,203 @@ type Logger interface {
 type Cors struct {
 	// Debug logger
 	Log Logger
-	// Normalized list of plain allowed origins
-	allowedOrigins [][]byte
-	// List of allowed origins containing wildcards
-	allowedWOrigins []wildcard
+	// Matcher of the allowed origins
+	allowedOrigins OriginMatcher
+	// Name of the option providing allowedOrigins, for logging
+	allowedOriginsReason string
+	// Optional matcher of the denied origins
+	deniedOrigins OriginMatcher
+	// Compiled ordered list of allow/deny rules
+	originRules []originRule
+	// Set to true to allow the "null" origin
+	allowNullOrigin bool
+	// Set to true when "null" is listed explicitly, or a custom matcher may match it
+	nullListed bool
+	// Optional matcher of the allowed browser extension origins
+	extensionOrigins OriginMatcher
+	// Optional matcher of the loopback origins
+	loopbackOrigins OriginMatcher
+	// Optional matcher of the origins in AllowedOriginCIDRs
+	cidrOrigins OriginMatcher
 	// Optional origin validator function
 	allowOriginFunc func(origin []byte) bool
 	// Optional origin validator (with request) function
 	allowOriginRequestFunc func(ctx *fasthttp.RequestCtx, origin []byte) bool
-	// Normalized list of allowed headers
-	allowedHeaders []string
-	// Normalized list of allowed methods
-	allowedMethods []string
-	// Normalized list of exposed headers
-	exposedHeaders []string
-	maxAge         int
+	// Default policy, applying to the origins without an OriginPolicies entry
+	policy
+	// Compiled per-origin policies, in matching order
+	originPolicies []originPolicy
 	// Set to true when allowed origins contains a "*"
 	allowedOriginsAll bool
-	// Set to true when allowed headers contains a "*"
-	allowedHeadersAll bool
-	allowCredentials  bool
+	// Set to true when every origin gets Access-Control-Allow-Origin: * without
+	// credentials, so responses don't vary by Origin
+	anyOrigin         bool
 	optionPassthrough bool
+	// Set to true to pass rejected preflights to the next handler
+	optionPassthroughRejected bool
+	// Status codes of the preflight responses
+	preflightSuccessStatus int
+	preflightFailureStatus int
+	reapplyAfterHandler    bool
+	recoverPanics          bool
+	repanic                bool
+	// How exposed headers are computed, and their options
+	exposeMode            ExposeMode
+	exposedHeaderPrefixes []string
+	exposeHeadersFunc     func(ctx *fasthttp.RequestCtx) []string
+	// Set to true to mirror Access-Control-Allow-Origin in Timing-Allow-Origin
+	timingAllowOrigin bool
+	// Timing-Allow-Origin of the requests without Origin
+	timingAllowOrigins []byte
+	// Pre-rendered cross-origin isolation headers
+	isolation []isolationHeader
+	// Set to true to reject cross-site requests using Fetch Metadata
+	resourceIsolation bool
+	// Set to true to check the origin of requests using unsafe methods
+	csrfGuard     bool
+	rejectHandler fasthttp.RequestHandler
+	// Proxies whose forwarded headers are trusted
+	trustedProxies trustedProxies
+	proxyHeaders   ProxyHeaders
+	// Set to true to skip the same-origin requests
+	skipSameOrigin bool
+	// Optional cache of rendered preflight responses
+	preflightCache *preflightCache
+	// Extra headers of preflight responses
+	preflightCacheControl    bool
+	preflightCDNCacheControl bool
+	preflightSurrogateKey    []byte
+	preflightAllowHeader     bool
+}
+
+// Validate checks the options for configuration errors, such as "site:" origins that
+// aren't registrable domains or invalid CIDRs.
+func (o Options) Validate() error {
+	if err := validateOrigins(o.AllowedOrigins); err != nil {
+		return err
+	}
+	if err := validateOrigins(o.DeniedOrigins); err != nil {
+		return err
+	}
+	for _, rule := range o.OriginRules {
+		if err := validateOrigins(rule.Origins); err != nil {
+			return err
+		}
+	}
+	for pattern := range o.OriginPolicies {
+		if err := validateOrigins([]string{pattern}); err != nil {
+			return err
+		}
+	}
+	if _, err := compileExtensions(o.AllowedExtensions); err != nil {
+		return err
+	}
+	if _, err := CIDROrigin(o.AllowedOriginCIDRs...); err != nil {
+		return err
+	}
+	if o.PreflightSuccessStatus != 0 && (o.PreflightSuccessStatus < 200 || o.PreflightSuccessStatus > 299) {
+		return errPreflightSuccessStatus
+	}
+	if o.PreflightFailureStatus != 0 && (o.PreflightFailureStatus < 200 || o.PreflightFailureStatus > 599) {
+		return errPreflightFailureStatus
+	}
+	if _, err := compileTrustedProxies(o.TrustedProxies); err != nil {
+		return err
+	}
+	if o.Isolation != nil {
+		if err := o.Isolation.Validate(); err != nil {
+			return err
+		}
+		// Even the default AllowedOrigins lets every origin load the resources
+		if o.Isolation.ResourcePolicy == "same-origin" {
+			return errIsolationSameOrigin
+		}
+	}
+	if o.Strict && o.allowsCredentials() && (o.AllowLoopback || len(o.AllowedOriginCIDRs) > 0) && !o.AllowPrivateNetworkCredentials {
+		return errPrivateNetworkCredentials
+	}
+	return nil
 }
 
-// New creates a new Cors handler with the provided options.
+// allowsCredentials checks if AllowCredentials or any of the OriginPolicies allow
+// credentials
+func (o Options) allowsCredentials() bool {
+	if o.AllowCredentials {
+		return true
+	}
+	for _, policy := range o.OriginPolicies {
+		if policy.AllowCredentials != nil && *policy.AllowCredentials {
+			return true
+		}
+	}
+	return false
+}
+
+// listsNull checks if a list of origins contains "null" explicitly
+func listsNull(origins []string) bool {
+	for _, origin := range origins {
+		if origin == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOrigins checks a list of origins using the AllowedOrigins syntax
+func validateOrigins(origins []string) error {
+	for _, origin := range origins {
+		if strings.HasPrefix(origin, sitePrefix) {
+			if _, err := newSiteOrigin(origin[len(sitePrefix):], false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// New creates a new Cors handler with the provided options. It panics if the options
+// are invalid, see Options.Validate.
 func New(options Options) *Cors {
+	if err := options.Validate(); err != nil {
+		panic(err)
+	}
 	c := &Cors{
-		exposedHeaders:         convert(options.ExposedHeaders, http.CanonicalHeaderKey),
-		allowOriginFunc:        options.AllowOriginFunc,
-		allowOriginRequestFunc: options.AllowOriginRequestFunc,
-		allowCredentials:       options.AllowCredentials,
-		maxAge:                 options.MaxAge,
-		optionPassthrough:      options.OptionsPassthrough,
+		allowOriginFunc:           options.AllowOriginFunc,
+		allowOriginRequestFunc:    options.AllowOriginRequestFunc,
+		policy:                    newPolicy(options),
+		optionPassthrough:         options.OptionsPassthrough,
+		optionPassthroughRejected: options.OptionsPassthroughRejected,
+		preflightSuccessStatus:    options.PreflightSuccessStatus,
+		preflightFailureStatus:    options.PreflightFailureStatus,
+		reapplyAfterHandler:       options.ReapplyAfterHandler,
+		recoverPanics:             options.RecoverPanics,
+		repanic:                   options.Repanic,
+		exposeMode:                options.ExposeMode,
+		preflightCacheControl:     options.PreflightCacheControl,
+		preflightCDNCacheControl:  options.PreflightCDNCacheControl,
+		preflightAllowHeader:      options.PreflightAllowHeader,
+		exposedHeaderPrefixes:     options.ExposedHeaderPrefixes,
+		exposeHeadersFunc:         options.ExposeHeadersFunc,
+		timingAllowOrigin:         options.TimingAllowOrigin,
+		resourceIsolation:         options.ResourceIsolation,
+		csrfGuard:                 options.CSRFGuard,
+		skipSameOrigin:            options.SkipSameOrigin,
+		proxyHeaders:              options.ProxyHeaders,
+		rejectHandler:             options.RejectHandler,
+		allowNullOrigin:           options.AllowNullOrigin,
+	}
+	if options.Isolation != nil {
+		c.isolation = compileIsolation(*options.Isolation)
+	}
+	c.trustedProxies, _ = compileTrustedProxies(options.TrustedProxies)
+	if c.rejectHandler == nil {
+		c.rejectHandler = defaultRejectHandler
+	}
+	if c.preflightSuccessStatus == 0 {
+		c.preflightSuccessStatus = http.StatusNoContent
+	}
+	if c.preflightFailureStatus == 0 {
+		c.preflightFailureStatus = c.preflightSuccessStatus
 	}
 	if options.Debug && c.Log == nil {
 		c.Log = log.New(os.Stdout, "[cors] ", log.LstdFlags)
@@ -120,63 +449,111 @@ func New(options Options) *Cors {
 
 	// Normalize options
 	// Note: for origins and methods matching, the spec requires a case-sensitive matching.
-	// As it may error prone, we chose to ignore the spec here.
+	// As it may error prone, we chose to ignore the spec here unless Strict is set.
+
+	// Denied Origins
+	c.deniedOrigins, _ = compileOrigins(options.DeniedOrigins, c.strict)
+
+	// Origin rules
+	c.originRules = compileOriginRules(options.OriginRules, c.strict)
+	c.nullListed = options.OriginMatcher != nil || listsNull(options.AllowedOrigins)
+	for _, rule := range options.OriginRules {
+		if rule.Action == RuleAllow && listsNull(rule.Origins) {
+			c.nullListed = true
+		}
+	}
+
+	// Browser extensions
+	if len(options.AllowedExtensions) > 0 {
+		c.extensionOrigins, _ = compileExtensions(options.AllowedExtensions)
+	}
+
+	// Loopback and private network origins
+	if options.AllowLoopback {
+		c.loopbackOrigins = LoopbackOrigin()
+	}
+	if len(options.AllowedOriginCIDRs) > 0 {
+		c.cidrOrigins, _ = CIDROrigin(options.AllowedOriginCIDRs...)
+	}
 
 	// Allowed Origins
-	if len(options.AllowedOrigins) == 0 {
-		if options.AllowOriginFunc == nil && options.AllowOriginRequestFunc == nil {
+	if options.OriginMatcher != nil {
+		c.allowedOrigins = options.OriginMatcher
+		c.allowedOriginsReason = "OriginMatcher"
+	} else if len(options.AllowedOrigins) == 0 {
+		if options.AllowOriginFunc == nil && options.AllowOriginRequestFunc == nil && len(c.originRules) == 0 &&
+			c.extensionOrigins == nil && c.loopbackOrigins == nil && c.cidrOrigins == nil {
 			// Default is all origins
+			c.allowedOrigins = anyOriginMatcher
 			c.allowedOriginsAll = true
 		}
 	} else {
-		c.allowedOrigins = [][]byte{}
-		c.allowedWOrigins = []wildcard{}
-		for _, origin := range options.AllowedOrigins {
-			// Normalize
-			origin = strings.ToLower(origin)
-			if origin == "*" {
-				// If "*" is present in the list, turn the whole list into a match all
-				c.allowedOriginsAll = true
-				c.allowedOrigins = nil
-				c.allowedWOrigins = nil
-				break
-			} else if i := strings.IndexByte(origin, '*'); i >= 0 {
-				// Split the origin in two: start and end string without the *
-				w := wildcard{[]byte(origin[0:i]), []byte(origin[i+1:])}
-				c.allowedWOrigins = append(c.allowedWOrigins, w)
-			} else {
-				c.allowedOrigins = append(c.allowedOrigins, []byte(origin))
-			}
-		}
+		// If "*" is present in the list, the whole list turns into a match all
+		c.allowedOrigins, c.allowedOriginsAll = compileOrigins(options.AllowedOrigins, c.strict)
+	}
+	if c.allowedOriginsReason == "" {
+		c.allowedOriginsReason = "AllowedOrigins"
 	}
 
-	// Allowed Headers
-	if len(options.AllowedHeaders) == 0 {
-		// Use sensible defaults
-		c.allowedHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}
-	} else {
-		// Origin is always appended as some browsers will always request for this header at preflight
-		c.allowedHeaders = convert(append(options.AllowedHeaders, "Origin"), http.CanonicalHeaderKey)
-		for _, h := range options.AllowedHeaders {
-			if h == "*" {
-				c.allowedHeadersAll = true
-				c.allowedHeaders = nil
-				break
-			}
-		}
+	if c.timingAllowOrigin && options.OriginMatcher == nil {
+		c.timingAllowOrigins = c.compileTimingAllowOrigins(options.AllowedOrigins)
 	}
 
-	// Allowed Methods
-	if len(options.AllowedMethods) == 0 {
-		// Default is spec's "simple" methods
-		c.allowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
-	} else {
-		c.allowedMethods = convert(options.AllowedMethods, strings.ToUpper)
+	// Per-origin policies
+	c.originPolicies = compileOriginPolicies(options)
+
+	// Responses don't depend on Origin when all origins are allowed with "*", unless
+	// some of them may be denied or get another policy. The null origin, never
+	// allowed by "*", can't read anything new from a public response.
+	c.anyOrigin = c.allowedOriginsAll && !c.allowCredentials && c.deniedOrigins == nil &&
+		len(c.originRules) == 0 && c.allowOriginFunc == nil && c.allowOriginRequestFunc == nil &&
+		len(c.originPolicies) == 0 && c.extensionOrigins == nil && c.loopbackOrigins == nil && c.cidrOrigins == nil
+
+	if options.PreflightSurrogateKey != "" {
+		c.preflightSurrogateKey = []byte(options.PreflightSurrogateKey)
+	}
+
+	if options.PreflightCacheSize > 0 && c.allowOriginRequestFunc == nil && !dependsOnRequest(c.originRules) {
+		c.preflightCache = newPreflightCache(options.PreflightCacheSize)
 	}
 
 	return c
 }
 
+// compileTimingAllowOrigins renders the Timing-Allow-Origin of the requests without
+// Origin: "*" when all origins are allowed, or the exact allowed origins, as patterns
+// can't be listed
+func (c *Cors) compileTimingAllowOrigins(origins []string) []byte {
+	if c.allowedOriginsAll && c.deniedOrigins == nil {
+		return headerWildcard
+	}
+	var value []byte
+	for _, origin := range origins {
+		if strings.IndexByte(origin, '*') >= 0 || strings.HasPrefix(origin, sitePrefix) {
+			continue
+		}
+		if !c.strict {
+			origin = strings.ToLower(origin)
+		}
+		if c.deniedOrigins != nil && c.deniedOrigins.Match([]byte(origin)) {
+			continue
+		}
+		if len(value) > 0 {
+			value = append(value, ", "...)
+		}
+		value = append(value, origin...)
+	}
+	return value
+}
+
+// InvalidatePreflightCache drops all the cached preflight responses. Call it whenever the
+// policy changes outside of the Options, e.g. when the result of AllowOriginFunc changes.
+func (c *Cors) InvalidatePreflightCache() {
+	if c.preflightCache != nil {
+		c.preflightCache.reset()
+	}
+}
+
 // Default creates a new Cors handler with default options.
 func Default() *Cors {
 	return New(Options{})
@@ -204,108 +581,268 @@ func AllowAll() *Cors {
 // as necessary.
 func (c *Cors) Handler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
+		if c.resourceIsolation && !c.allowResourceIsolation(ctx) {
+			c.logf("Handler: Request rejected by resource isolation")
+			c.rejectHandler(ctx)
+			return
+		}
+		if c.csrfGuard && !c.allowCSRF(ctx) {
+			c.logf("Handler: Request rejected by CSRF guard")
+			c.rejectHandler(ctx)
+			return
+		}
 		if ctx.IsOptions() && len(ctx.Request.Header.Peek("Access-Control-Request-Method")) != 0 {
 			c.logf("Handler: Preflight request")
-			c.handlePreflight(ctx)
+			allowed := c.handlePreflight(ctx)
 			// Preflight requests are standalone and should stop the chain as some other
 			// middleware may not handle OPTIONS requests correctly. One typical example
 			// is authentication middleware ; OPTIONS requests won't carry authentication
 			// headers (see #1)
-			if c.optionPassthrough {
+			if c.optionPassthrough || !allowed && c.optionPassthroughRejected {
 				h(ctx)
 				return
 			}
 
-			ctx.SetStatusCode(http.StatusNoContent)
+			if allowed {
+				ctx.SetStatusCode(c.preflightSuccessStatus)
+			} else {
+				ctx.SetStatusCode(c.preflightFailureStatus)
+			}
 			return
 		}
 
 		c.logf("Handler: Actual request")
-		c.handleActualRequest(ctx)
+		if c.exposeMode == ExposeStatic {
+			c.handleActualRequest(ctx)
+		}
+		if c.recoverPanics {
+			defer c.recoverPanic(ctx)
+		}
 		h(ctx)
+		if c.exposeMode != ExposeStatic || c.reapplyAfterHandler {
+			c.reapplyActualRequest(ctx)
+		}
 	}
 }
 
-// handlePreflight handles pre-flight CORS requests
-func (c *Cors) handlePreflight(ctx *fasthttp.RequestCtx) {
-	headers := &ctx.Response.Header
-	origin := ctx.Request.Header.Peek("Origin")
-
+// handlePreflight handles pre-flight CORS requests, reporting whether the preflight was
+// successful
+func (c *Cors) handlePreflight(ctx *fasthttp.RequestCtx) bool {
 	if !ctx.IsOptions() {
-		c.logf("  Preflight aborted: %s!=OPTIONS", string(ctx.Request.Header.Method()))
-		return
+		if c.Log != nil {
+			c.logf("  Preflight aborted: %s!=OPTIONS", string(ctx.Request.Header.Method()))
+		}
+		return false
 	}
 
-	// Always set Vary headers
-	// see https://github.com/rs/cors/issues/10,
-	//     https://github.com/rs/cors/commit/dbdca4d95feaa7511a46e6f1efb3b3aa505bc43f#commitcomment-12352001
-	headers.Add("Vary", "Origin")
-	headers.Add("Vary", "Access-Control-Request-Method")
-	headers.Add("Vary", "Access-Control-Request-Headers")
+	var allowed bool
+	if c.preflightCache != nil {
+		allowed = c.writeCachedPreflight(ctx)
+	} else {
+		allowed = c.writePreflight(ctx, &ctx.Response.Header)
+	}
+	addVary(&ctx.Response.Header, c.preflightVary(allowed))
+	if !allowed {
+		c.writePreflightExtras(&ctx.Response.Header, headerNoStore, nil)
+	}
 
+	if allowed && c.Log != nil {
+		c.logf("  Preflight response headers: %v", &ctx.Response.Header)
+	}
+	return allowed
+}
+
+// writeCachedPreflight writes the preflight response from the cache, rendering and
+// caching it first on a miss. It reports whether the preflight was successful.
+func (c *Cors) writeCachedPreflight(ctx *fasthttp.RequestCtx) bool {
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	*buf = appendPreflightCacheKey(*buf, ctx)
+	if len(*buf) > maxPreflightCacheKeyLength {
+		c.logf("  Preflight not cached: key too long")
+		return c.writePreflight(ctx, &ctx.Response.Header)
+	}
+
+	e := c.preflightCache.get(*buf)
+	if e != nil {
+		c.logf("  Preflight served from cache")
+	} else {
+		e = &preflightCacheEntry{}
+		e.allowed = c.writePreflight(ctx, e)
+		c.preflightCache.put(*buf, e)
+	}
+	e.writeTo(&ctx.Response.Header)
+	return e.allowed
+}
+
+// writePreflight computes the CORS headers of a preflight request and writes them to
+// headers, which is either the response headers or a preflight cache entry. It reports
+// whether the preflight was successful. Vary is left to the caller, see preflightVary.
+func (c *Cors) writePreflight(ctx *fasthttp.RequestCtx, headers headerWriter) bool {
+	origin := ctx.Request.Header.Peek("Origin")
 	if len(origin) == 0 {
 		c.logf("  Preflight aborted: empty origin")
-		return
+		return false
 	}
 
-	if !c.isOriginAllowed(ctx, origin) {
-		c.logf("  Preflight aborted: origin '%s' not allowed", origin)
-		return
+	reqMethod := ctx.Request.Header.Peek("Access-Control-Request-Method")
+	decision := c.checkOrigin(ctx, origin, reqMethod)
+	if !decision.allowed {
+		if c.Log != nil {
+			c.logf("  Preflight aborted: origin '%s' %s", origin, decision)
+		}
+		return false
 	}
 
-	reqMethod := ctx.Request.Header.Peek("Access-Control-Request-Method")
-	if !c.isMethodAllowed(reqMethod) {
-		c.logf("  Preflight aborted: method '%s' not allowed", reqMethod)
-		return
+	p := c.policyFor(origin)
+	if !p.isMethodAllowed(reqMethod) {
+		if c.Log != nil {
+			c.logf("  Preflight aborted: method '%s' not allowed", reqMethod)
+		}
+		return false
 	}
 
-	reqHeaders := parseHeaderList(ctx.Request.Header.Peek("Access-Control-Request-Headers"))
-	if !c.areHeadersAllowed(reqHeaders) {
-		c.logf("  Preflight aborted: headers '%v' not allowed", reqHeaders)
-		return
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	// Render the method and the list of requested headers in the same buffer
+	*buf = p.appendMethod(*buf, reqMethod)
+	allowMethods := *buf
+	reqHeaders, authorization, err := p.appendRequestHeaders(*buf, ctx)
+	*buf = reqHeaders
+	reqHeaders = reqHeaders[len(allowMethods):]
+	if err != nil {
+		if c.Log != nil {
+			c.logf("  Preflight aborted: %v in '%s'", err, reqHeaders)
+		}
+		return false
 	}
 
-	if c.allowedOriginsAll {
-		headers.Set("Access-Control-Allow-Origin", "*")
+	if c.Log != nil {
+		c.logf("  Preflight origin '%s' %s", origin, decision)
+	}
+	if decision.wildcard {
+		headers.SetBytesV("Access-Control-Allow-Origin", headerWildcard)
 	} else {
 		headers.SetBytesV("Access-Control-Allow-Origin", origin)
 	}
 
-	// Spec says: Since the list of methods can be unbounded, simply returning the method indicated
-	// by Access-Control-Request-Method (if supported) can be enough
-	headers.SetBytesV("Access-Control-Allow-Methods", bytes.ToUpper(reqMethod))
+	// Fetch spec: "*" is only treated as a wildcard for requests without credentials,
+	// so fall back to echoing the request when credentials are allowed.
+	if p.allowedMethodsAll && !p.allowCredentials {
+		headers.SetBytesV("Access-Control-Allow-Methods", headerWildcard)
+	} else {
+		// Spec says: Since the list of methods can be unbounded, simply returning the method indicated
+		// by Access-Control-Request-Method (if supported) can be enough
+		headers.SetBytesV("Access-Control-Allow-Methods", allowMethods)
+	}
 	if len(reqHeaders) > 0 {
-
-		// Spec says: Since the list of headers can be unbounded, simply returning supported headers
-		// from Access-Control-Request-Headers can be enough
-		headers.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+		if p.allowedHeadersAll && !p.allowCredentials {
+			// The "*" wildcard never covers Authorization, it has to be listed explicitly
+			if authorization {
+				headers.SetBytesV("Access-Control-Allow-Headers", headerWildcardAuthorization)
+			} else {
+				headers.SetBytesV("Access-Control-Allow-Headers", headerWildcard)
+			}
+		} else {
+			// Spec says: Since the list of headers can be unbounded, simply returning supported headers
+			// from Access-Control-Request-Headers can be enough
+			headers.SetBytesV("Access-Control-Allow-Headers", reqHeaders)
+		}
 	}
 
-	if c.allowCredentials {
-		headers.Set("Access-Control-Allow-Credentials", "true")
+	if p.allowCredentials {
+		headers.SetBytesV("Access-Control-Allow-Credentials", headerTrue)
 	}
 
-	if c.maxAge > 0 {
-		headers.Set("Access-Control-Max-Age", strconv.Itoa(c.maxAge))
+	if len(p.maxAgeValue) > 0 {
+		headers.SetBytesV("Access-Control-Max-Age", p.maxAgeValue)
 	}
 
-	c.logf("  Preflight response headers: %v", headers)
+	c.writePreflightExtras(headers, p.cacheControlValue, p.allowValue)
+	return true
+}
+
+// writePreflightExtras writes the optional cache and Allow headers of a preflight
+// response
+func (c *Cors) writePreflightExtras(headers headerWriter, cacheControl, allow []byte) {
+	if c.preflightCacheControl {
+		headers.SetBytesV("Cache-Control", cacheControl)
+	}
+	if c.preflightCDNCacheControl {
+		headers.SetBytesV("CDN-Cache-Control", cacheControl)
+	}
+	if len(c.preflightSurrogateKey) > 0 {
+		headers.SetBytesV("Surrogate-Key", c.preflightSurrogateKey)
+	}
+	if c.preflightAllowHeader {
+		if len(allow) > 0 {
+			headers.SetBytesV("Allow", allow)
+		}
+		headers.SetBytesV("Content-Length", headerZero)
+	}
 }
 
 // handleActualRequest handles simple cross-origin requests, actual request or redirects
 func (c *Cors) handleActualRequest(ctx *fasthttp.RequestCtx) {
-	headers := &ctx.Response.Header
+	c.writeActualRequest(ctx, &ctx.Response.Header, false)
+}
+
+// reapplyActualRequest writes the CORS headers of an actual request once the handler
+// returned, keeping the ones it wrote. Headers lost to a ctx.Response.Reset are
+// written again.
+func (c *Cors) reapplyActualRequest(ctx *fasthttp.RequestCtx) {
+	c.writeActualRequest(ctx, &ctx.Response.Header, true)
+}
+
+// writeActualRequest writes the CORS headers of an actual request to headers, either
+// the ones of the response of ctx or of a replacement response. When keep is set, the
+// CORS headers already present are left untouched.
+func (c *Cors) writeActualRequest(ctx *fasthttp.RequestCtx, headers *fasthttp.ResponseHeader, keep bool) {
+	writeIsolation(headers, c.isolation, keep)
 	origin := ctx.Request.Header.Peek("Origin")
 
-	// Always set Vary, see https://github.com/rs/cors/issues/10
-	headers.Add("Vary", "Origin")
-	if len(origin) == 0 {
-		c.logf("  Actual request no headers added: missing origin")
+	// Set Vary unless all origins get the same response, see
+	// https://github.com/rs/cors/issues/10
+	if !c.anyOrigin {
+		addVary(headers, varyOrigin)
+	}
+
+	if c.skipSameOrigin && len(origin) > 0 && c.isSameOrigin(ctx, origin) {
+		if c.anyOrigin {
+			// Cross-origin requests get "*", so same-origin responses must not be reused
+			addVary(headers, varyOrigin)
+		}
+		if c.Log != nil {
+			c.logf("  Actual request no headers added: same-origin request from '%s'", origin)
+		}
 		return
 	}
 
-	if !c.isOriginAllowed(ctx, origin) {
-		c.logf("  Actual request no headers added: origin '%s' not allowed", origin)
+	var decision originDecision
+	if len(origin) > 0 {
+		decision = c.checkOrigin(ctx, origin, ctx.Request.Header.Method())
+	} else if c.anyOrigin {
+		// Requests without Origin get "*" too, so their response can be cached and
+		// reused for cross-origin requests
+		decision = originDecision{allowed: true, wildcard: true, reason: c.allowedOriginsReason}
+	} else {
+		if len(c.timingAllowOrigins) > 0 {
+			// no-cors loads, such as images or scripts, don't send Origin
+			setActualHeader(headers, keep, "Timing-Allow-Origin", c.timingAllowOrigins)
+		}
+		c.logf("  Actual request no headers added: missing origin")
+		return
+	}
+	if !decision.allowed {
+		if c.anyOrigin {
+			// The null origin and malformed origins in strict mode still vary
+			addVary(headers, varyOrigin)
+		}
+		if c.Log != nil {
+			c.logf("  Actual request no headers added: origin '%s' %s", origin, decision)
+		}
 		return
 	}
 
@@ -313,101 +850,263 @@ func (c *Cors) handleActualRequest(ctx *fasthttp.RequestCtx) {
 	// POST. Access-Control-Allow-Methods is only used for pre-flight requests and the
 	// spec doesn't instruct to check the allowed methods for simple cross-origin requests.
 	// We think it's a nice feature to be able to have control on those methods though.
-	if !c.isMethodAllowed(ctx.Request.Header.Method()) {
-		c.logf("  Actual request no headers added: method '%s' not allowed", string(ctx.Request.Header.Method()))
+	p := c.policyFor(origin)
+	if !p.isMethodAllowed(ctx.Request.Header.Method()) {
+		if c.Log != nil {
+			c.logf("  Actual request no headers added: method '%s' not allowed", string(ctx.Request.Header.Method()))
+		}
 		return
 	}
 
-	if c.allowedOriginsAll {
-		headers.Set("Access-Control-Allow-Origin", "*")
+	if c.Log != nil {
+		c.logf("  Actual request origin '%s' %s", origin, decision)
+	}
+	allowOrigin := origin
+	if decision.wildcard {
+		allowOrigin = headerWildcard
+	}
+	setActualHeader(headers, keep, "Access-Control-Allow-Origin", allowOrigin)
+	if c.timingAllowOrigin {
+		setActualHeader(headers, keep, "Timing-Allow-Origin", allowOrigin)
+	}
+
+	if c.exposeMode == ExposeStatic || p.exposedHeadersAll && !p.allowCredentials {
+		if len(p.exposedHeadersValue) > 0 {
+			setActualHeader(headers, keep, "Access-Control-Expose-Headers", p.exposedHeadersValue)
+		}
 	} else {
-		headers.SetBytesV("Access-Control-Allow-Origin", origin)
+		buf := acquireBuffer()
+		*buf = c.appendExposedHeaders(*buf, ctx, headers, p)
+		if len(*buf) > 0 {
+			setActualHeader(headers, keep, "Access-Control-Expose-Headers", *buf)
+		}
+		releaseBuffer(buf)
+	}
+
+	if p.allowCredentials {
+		setActualHeader(headers, keep, "Access-Control-Allow-Credentials", headerTrue)
+	}
+
+	if c.Log != nil {
+		c.logf("  Actual response added headers: %v", headers)
+	}
+}
+
+// recoverPanic recovers a panic of the handler, replacing the response with a 500
+// Internal Server Error carrying the CORS headers. It must be deferred.
+func (c *Cors) recoverPanic(ctx *fasthttp.RequestCtx) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	ctx.Response.Reset()
+	ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+	c.reapplyActualRequest(ctx)
+	if c.repanic {
+		panic(r)
+	}
+	if c.Log != nil {
+		c.Log.Printf("panic serving %s: %v\n%s", ctx.RequestURI(), r, debug.Stack())
+	} else {
+		log.Printf("cors: panic serving %s: %v\n%s", ctx.RequestURI(), r, debug.Stack())
 	}
+}
 
-	if len(c.exposedHeaders) > 0 {
-		headers.Set("Access-Control-Expose-Headers", strings.Join(c.exposedHeaders, ", "))
+// setActualHeader sets a CORS header of an actual response, unless keep is set and the
+// response already has it
+func setActualHeader(headers *fasthttp.ResponseHeader, keep bool, key string, value []byte) {
+	if keep && len(headers.Peek(key)) > 0 {
+		return
 	}
+	headers.SetBytesV(key, value)
+}
 
-	if c.allowCredentials {
-		headers.Set("Access-Control-Allow-Credentials", "true")
+// preflightVary returns the Vary values of a preflight response
+func (c *Cors) preflightVary(allowed bool) []byte {
+	if c.anyOrigin && allowed {
+		return varyPreflightAnyOrigin
 	}
+	return varyPreflight
+}
 
-	c.logf("  Actual response added headers: %v", headers)
+// appendRequestHeaders parses all the Access-Control-Request-Headers lines of a preflight
+// request and appends the canonical, comma separated list of requested headers to dst,
+// checking each of them against the allowed headers without allocating. It reports
+// whether Authorization was requested, and returns errHeaderNotAllowed as soon as a
+// header isn't allowed, that header being the last one of the list.
+func (p *policy) appendRequestHeaders(dst []byte, ctx *fasthttp.RequestCtx) ([]byte, bool, error) {
+	var authorization bool
+	var err error
+	base := len(dst)
+	count := 0
+	length := 0
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		if err != nil || !equalFoldString(key, "Access-Control-Request-Headers") {
+			return
+		}
+		length += len(value)
+		if length > maxRequestHeadersLength {
+			err = errHeaderListTooLong
+			return
+		}
+		for i := 0; ; {
+			var token []byte
+			token, i, err = nextHeaderToken(value, i)
+			if err != nil || token == nil {
+				return
+			}
+			if count++; count > maxRequestHeaders {
+				err = errTooManyHeaders
+				return
+			}
+			if len(dst) > base {
+				dst = append(dst, ", "...)
+			}
+			start := len(dst)
+			dst = appendCanonicalHeaderKey(dst, token)
+			header := dst[start:]
+			if string(header) == "Authorization" {
+				authorization = true
+			}
+			if _, ok := p.allowedHeadersSet[string(header)]; !ok && !p.allowedHeadersAll {
+				err = errHeaderNotAllowed
+				return
+			}
+		}
+	})
+	return dst, authorization, err
 }
 
 // convenience method. checks if a logger is set.
+// Calls passing arguments should be guarded by a c.Log != nil check, as boxing the
+// arguments allocates even when no logger is set.
 func (c *Cors) logf(format string, a ...interface{}) {
 	if c.Log != nil {
 		c.Log.Printf(format, a...)
 	}
 }
 
-// isOriginAllowed checks if a given origin is allowed to perform cross-domain requests
-// on the endpoint
-func (c *Cors) isOriginAllowed(ctx *fasthttp.RequestCtx, origin []byte) bool {
-	if c.allowOriginRequestFunc != nil {
-		return c.allowOriginRequestFunc(ctx, origin)
+// originDecision records the outcome of the origin check of a request, and what
+// decided it, for logging
+type originDecision struct {
+	allowed bool
+	// Set when the origin is explicitly denied rather than not allowed
+	denied bool
+	// Set when the response should allow any origin with "*" rather than reflect it
+	wildcard bool
+	// What took the decision
+	reason string
+}
+
+// String describes the decision for debug logs
+func (d originDecision) String() string {
+	switch {
+	case d.wildcard && !d.allowed:
+		return "only allowed by * in " + d.reason
+	case d.allowed:
+		return "allowed by " + d.reason
+	case d.denied:
+		return "denied by " + d.reason
+	default:
+		return "not allowed by " + d.reason
 	}
-	if c.allowOriginFunc != nil {
-		return c.allowOriginFunc(origin)
+}
+
+// checkOriginExplicitly is checkOrigin for the guards rejecting requests: the origins
+// only allowed by a "*" in AllowedOrigins aren't allowed, as "*" lets any origin read
+// responses without vouching for it
+func (c *Cors) checkOriginExplicitly(ctx *fasthttp.RequestCtx, origin, method []byte) originDecision {
+	decision := c.checkOrigin(ctx, origin, method)
+	if decision.wildcard {
+		decision.allowed = false
 	}
-	if c.allowedOriginsAll {
-		return true
+	return decision
+}
+
+// checkOrigin checks if a given origin is allowed to perform cross-domain requests
+// on the endpoint. method is the method of the actual request, i.e. the requested
+// method for preflights.
+func (c *Cors) checkOrigin(ctx *fasthttp.RequestCtx, origin, method []byte) originDecision {
+	if c.strict && !isOriginValid(origin) {
+		return originDecision{reason: "Strict (malformed origin)"}
 	}
-	origin = bytes.ToLower(origin)
-	for _, o := range c.allowedOrigins {
-		if bytes.Equal(o, origin) {
-			return true
+	if c.deniedOrigins != nil && c.deniedOrigins.Match(origin) {
+		return originDecision{denied: true, reason: "DeniedOrigins"}
+	}
+	if string(origin) == "null" {
+		if c.allowNullOrigin {
+			return originDecision{allowed: true, wildcard: c.allowedOriginsAll, reason: "AllowNullOrigin"}
+		}
+		if c.allowOriginRequestFunc == nil && c.allowOriginFunc == nil && !c.nullListed {
+			// "*" doesn't extend to opaque origins, neither in AllowedOrigins nor in rules
+			return originDecision{reason: "AllowNullOrigin"}
 		}
 	}
-	for _, w := range c.allowedWOrigins {
-		if w.match(origin) {
-			return true
+	for i := range c.originRules {
+		r := &c.originRules[i]
+		if r.match(ctx, origin, method, c.strict) {
+			return originDecision{allowed: !r.deny, denied: r.deny, reason: r.name}
 		}
 	}
-	return false
+	if c.extensionOrigins != nil && c.extensionOrigins.Match(origin) {
+		return originDecision{allowed: true, reason: "AllowedExtensions"}
+	}
+	if c.loopbackOrigins != nil && c.loopbackOrigins.Match(origin) {
+		return originDecision{allowed: true, reason: "AllowLoopback"}
+	}
+	if c.cidrOrigins != nil && c.cidrOrigins.Match(origin) {
+		return originDecision{allowed: true, reason: "AllowedOriginCIDRs"}
+	}
+	if c.allowOriginRequestFunc != nil {
+		return originDecision{allowed: c.allowOriginRequestFunc(ctx, origin), reason: "AllowOriginRequestFunc"}
+	}
+	if c.allowOriginFunc != nil {
+		return originDecision{allowed: c.allowOriginFunc(origin), reason: "AllowOriginFunc"}
+	}
+	if c.allowedOrigins == nil {
+		return originDecision{reason: c.allowedOriginsReason}
+	}
+	return originDecision{
+		allowed:  c.allowedOrigins.Match(origin),
+		wildcard: c.allowedOriginsAll,
+		reason:   c.allowedOriginsReason,
+	}
+}
+
+// isOriginAllowed checks if a given origin is allowed to perform cross-domain requests
+// on the endpoint
+func (c *Cors) isOriginAllowed(ctx *fasthttp.RequestCtx, origin []byte) bool {
+	return c.checkOrigin(ctx, origin, ctx.Request.Header.Method()).allowed
 }
 
 // isMethodAllowed checks if a given method can be used as part of a cross-domain request
 // on the endpoint
-func (c *Cors) isMethodAllowed(method []byte) bool {
-	if len(c.allowedMethods) == 0 {
+func (p *policy) isMethodAllowed(method []byte) bool {
+	if p.allowedMethodsAll {
+		return true
+	}
+	if len(p.allowedMethods) == 0 {
 		// If no method allowed, always return false, even for preflight request
 		return false
 	}
 
-	method = bytes.ToUpper(method)
-
-	if string(method) == http.MethodOptions {
+	if equalFoldString(method, http.MethodOptions) {
 		// Always allow preflight requests
 		return true
 	}
-	for _, m := range c.allowedMethods {
-		if m == string(method) {
+	for _, m := range p.allowedMethods {
+		if matchMethod(method, m, p.strict) {
 			return true
 		}
 	}
 	return false
 }
 
-// areHeadersAllowed checks if a given list of headers are allowed to used within
-// a cross-domain request.
-func (c *Cors) areHeadersAllowed(requestedHeaders []string) bool {
-	if c.allowedHeadersAll || len(requestedHeaders) == 0 {
-		return true
+// appendMethod appends the normalized request method to dst. In strict mode, only the
+// methods normalized by the Fetch spec are upper-cased.
+func (p *policy) appendMethod(dst, method []byte) []byte {
+	if p.strict && !isNormalizedMethod(method) {
+		return append(dst, method...)
 	}
-	for _, header := range requestedHeaders {
-		header = http.CanonicalHeaderKey(header)
-		found := false
-		for _, h := range c.allowedHeaders {
-			if h == header {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	}
-	return true
+	return appendUpper(dst, method)
 }
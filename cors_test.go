@@ -1,6 +1,7 @@
 package cors
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
@@ -22,11 +23,17 @@ var allHeaders = []string{
 	"Access-Control-Allow-Credentials",
 	"Access-Control-Max-Age",
 	"Access-Control-Expose-Headers",
+	"Cache-Control",
+	"CDN-Cache-Control",
+	"Surrogate-Key",
+	"Allow",
+	"Content-Length",
+	"Timing-Allow-Origin",
 }
 
 func assertHeaders(t *testing.T, ctx *fasthttp.RequestCtx, expHeaders map[string]string) {
 	for _, name := range allHeaders {
-		got := strings.Join(headerValues(ctx, name), ", ")
+		got := joinHeaderValues(ctx, name)
 		want := expHeaders[name]
 		if got != want {
 			t.Errorf("Response header %q = %q, want %q", name, got, want)
@@ -34,6 +41,10 @@ func assertHeaders(t *testing.T, ctx *fasthttp.RequestCtx, expHeaders map[string
 	}
 }
 
+func joinHeaderValues(ctx *fasthttp.RequestCtx, key string) string {
+	return strings.Join(headerValues(ctx, key), ", ")
+}
+
 func headerValues(ctx *fasthttp.RequestCtx, key string) []string {
 	var results []string
 
@@ -68,7 +79,7 @@ func TestSpec(t *testing.T) {
 			"GET",
 			map[string]string{},
 			map[string]string{
-				"Vary": "Origin",
+				"Access-Control-Allow-Origin": "*",
 			},
 		},
 		{
@@ -81,7 +92,6 @@ func TestSpec(t *testing.T) {
 				"Origin": "http://foobar.com",
 			},
 			map[string]string{
-				"Vary":                        "Origin",
 				"Access-Control-Allow-Origin": "*",
 			},
 		},
@@ -129,6 +139,105 @@ func TestSpec(t *testing.T) {
 				"Access-Control-Allow-Origin": "http://foo.bar.com",
 			},
 		},
+		{
+			"TimingAllowOrigin",
+			Options{
+				AllowedOrigins:    []string{"http://foobar.com"},
+				TimingAllowOrigin: true,
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com",
+				"Timing-Allow-Origin":         "http://foobar.com",
+			},
+		},
+		{
+			"TimingAllowOriginNoOrigin",
+			Options{
+				AllowedOrigins:    []string{"http://foobar.com", "http://*.foobar.com", "https://App.com", "site:example.com"},
+				TimingAllowOrigin: true,
+			},
+			"GET",
+			map[string]string{},
+			map[string]string{
+				"Vary":                "Origin",
+				"Timing-Allow-Origin": "http://foobar.com, https://app.com",
+			},
+		},
+		{
+			"TimingAllowOriginWildcardNoOrigin",
+			Options{
+				TimingAllowOrigin: true,
+			},
+			"GET",
+			map[string]string{},
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Timing-Allow-Origin":         "*",
+			},
+		},
+		{
+			"TimingAllowOriginDeniedNoOrigin",
+			Options{
+				DeniedOrigins:     []string{"http://evil.com"},
+				TimingAllowOrigin: true,
+			},
+			"GET",
+			map[string]string{},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"TimingAllowOriginWildcard",
+			Options{
+				AllowedOrigins:    []string{"*"},
+				TimingAllowOrigin: true,
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Timing-Allow-Origin":         "*",
+			},
+		},
+		{
+			"TimingAllowOriginDisallowed",
+			Options{
+				AllowedOrigins:    []string{"http://foobar.com"},
+				TimingAllowOrigin: true,
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://barbaz.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"TimingAllowOriginPreflight",
+			Options{
+				AllowedOrigins:    []string{"http://foobar.com"},
+				TimingAllowOrigin: true,
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			map[string]string{
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "GET",
+			},
+		},
 		{
 			"DisallowedOrigin",
 			Options{
@@ -155,6 +264,107 @@ func TestSpec(t *testing.T) {
 				"Vary": "Origin",
 			},
 		},
+		{
+			"DeniedOrigin",
+			Options{
+				AllowedOrigins: []string{"*"},
+				DeniedOrigins:  []string{"http://foobar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://FOOBAR.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"NotDeniedOrigin",
+			Options{
+				AllowedOrigins: []string{"*"},
+				DeniedOrigins:  []string{"http://foobar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://barbaz.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "*",
+			},
+		},
+		{
+			"DeniedWildcardOrigin",
+			Options{
+				AllowedOrigins: []string{"http://*.bar.com"},
+				DeniedOrigins:  []string{"http://*.legacy.bar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foo.legacy.bar.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"DeniedOriginFunc",
+			Options{
+				AllowOriginFunc: func(o []byte) bool {
+					return true
+				},
+				DeniedOrigins: []string{"http://foobar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"DeniedOriginPreflight",
+			Options{
+				DeniedOrigins: []string{"http://foobar.com"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			"OriginMatcher",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				OriginMatcher:  Any(SuffixOrigin(".bar.com"), LoopbackOrigin()),
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://localhost:3000",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://localhost:3000",
+			},
+		},
+		{
+			"OriginMatcherNotMatch",
+			Options{
+				OriginMatcher: Any(SuffixOrigin(".bar.com"), LoopbackOrigin()),
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
 		{
 			"AllowedOriginFuncMatch",
 			Options{
@@ -309,111 +519,237 @@ func TestSpec(t *testing.T) {
 				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
 				"Access-Control-Allow-Origin":  "http://foobar.com",
 				"Access-Control-Allow-Methods": "GET",
-				"Access-Control-Allow-Headers": "X-Header-2, X-Header-1",
+				"Access-Control-Allow-Headers": "*",
 			},
 		},
 		{
-			"DisallowedHeader",
+			"AllowedWildcardHeaderAuthorization",
 			Options{
 				AllowedOrigins: []string{"http://foobar.com"},
-				AllowedHeaders: []string{"X-Header-1", "x-header-2"},
+				AllowedHeaders: []string{"*"},
 			},
 			"OPTIONS",
 			map[string]string{
 				"Origin":                         "http://foobar.com",
 				"Access-Control-Request-Method":  "GET",
-				"Access-Control-Request-Headers": "X-Header-3, X-Header-1",
+				"Access-Control-Request-Headers": "X-Header-1, authorization",
 			},
 			map[string]string{
-				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "GET",
+				"Access-Control-Allow-Headers": "*, Authorization",
 			},
 		},
 		{
-			"OriginHeader",
+			"AllowedWildcardHeaderWithCredentials",
 			Options{
-				AllowedOrigins: []string{"http://foobar.com"},
+				AllowedOrigins:   []string{"http://foobar.com"},
+				AllowedHeaders:   []string{"*"},
+				AllowCredentials: true,
 			},
 			"OPTIONS",
 			map[string]string{
 				"Origin":                         "http://foobar.com",
 				"Access-Control-Request-Method":  "GET",
-				"Access-Control-Request-Headers": "origin",
+				"Access-Control-Request-Headers": "X-Header-2, X-HEADER-1",
 			},
 			map[string]string{
-				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
-				"Access-Control-Allow-Origin":  "http://foobar.com",
-				"Access-Control-Allow-Methods": "GET",
-				"Access-Control-Allow-Headers": "Origin",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":      "http://foobar.com",
+				"Access-Control-Allow-Methods":     "GET",
+				"Access-Control-Allow-Headers":     "X-Header-2, X-Header-1",
+				"Access-Control-Allow-Credentials": "true",
 			},
 		},
 		{
-			"ExposedHeader",
+			"AllowedWildcardMethod",
 			Options{
 				AllowedOrigins: []string{"http://foobar.com"},
-				ExposedHeaders: []string{"X-Header-1", "x-header-2"},
+				AllowedMethods: []string{"*"},
 			},
-			"GET",
+			"OPTIONS",
 			map[string]string{
-				"Origin": "http://foobar.com",
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "PATCH",
 			},
 			map[string]string{
-				"Vary":                          "Origin",
-				"Access-Control-Allow-Origin":   "http://foobar.com",
-				"Access-Control-Expose-Headers": "X-Header-1, X-Header-2",
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "*",
 			},
 		},
 		{
-			"AllowedCredentials",
+			"AllowedWildcardMethodWithCredentials",
 			Options{
 				AllowedOrigins:   []string{"http://foobar.com"},
+				AllowedMethods:   []string{"*"},
 				AllowCredentials: true,
 			},
 			"OPTIONS",
 			map[string]string{
 				"Origin":                        "http://foobar.com",
-				"Access-Control-Request-Method": "GET",
+				"Access-Control-Request-Method": "PATCH",
 			},
 			map[string]string{
 				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
 				"Access-Control-Allow-Origin":      "http://foobar.com",
-				"Access-Control-Allow-Methods":     "GET",
+				"Access-Control-Allow-Methods":     "PATCH",
 				"Access-Control-Allow-Credentials": "true",
 			},
 		},
 		{
-			"OptionPassthrough",
+			"DisallowedHeader",
 			Options{
-				OptionsPassthrough: true,
+				AllowedOrigins: []string{"http://foobar.com"},
+				AllowedHeaders: []string{"X-Header-1", "x-header-2"},
 			},
 			"OPTIONS",
 			map[string]string{
-				"Origin":                        "http://foobar.com",
-				"Access-Control-Request-Method": "GET",
+				"Origin":                         "http://foobar.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Header-3, X-Header-1",
+			},
+			map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			"InvalidHeaderToken",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				AllowedHeaders: []string{"*"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                         "http://foobar.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Foo@Bar",
+			},
+			map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			"OriginHeader",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                         "http://foobar.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "origin",
 			},
 			map[string]string{
 				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
-				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
 				"Access-Control-Allow-Methods": "GET",
+				"Access-Control-Allow-Headers": "Origin",
 			},
 		},
 		{
-			"NonPreflightOptions",
+			"ExposedHeader",
 			Options{
 				AllowedOrigins: []string{"http://foobar.com"},
+				ExposedHeaders: []string{"X-Header-1", "x-header-2"},
 			},
-			"OPTIONS",
+			"GET",
 			map[string]string{
 				"Origin": "http://foobar.com",
 			},
 			map[string]string{
-				"Vary":                        "Origin",
-				"Access-Control-Allow-Origin": "http://foobar.com",
+				"Vary":                          "Origin",
+				"Access-Control-Allow-Origin":   "http://foobar.com",
+				"Access-Control-Expose-Headers": "X-Header-1, X-Header-2",
 			},
 		},
-	}
-	for i := range cases {
-		tc := cases[i]
-		t.Run(tc.name, func(t *testing.T) {
+		{
+			"ExposedWildcardHeader",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				ExposedHeaders: []string{"*", "X-Header-1"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                          "Origin",
+				"Access-Control-Allow-Origin":   "http://foobar.com",
+				"Access-Control-Expose-Headers": "*",
+			},
+		},
+		{
+			"ExposedWildcardHeaderWithCredentials",
+			Options{
+				AllowedOrigins:   []string{"http://foobar.com"},
+				ExposedHeaders:   []string{"*", "X-Header-1"},
+				AllowCredentials: true,
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                             "Origin",
+				"Access-Control-Allow-Origin":      "http://foobar.com",
+				"Access-Control-Expose-Headers":    "X-Header-1",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			"AllowedCredentials",
+			Options{
+				AllowedOrigins:   []string{"http://foobar.com"},
+				AllowCredentials: true,
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			map[string]string{
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":      "http://foobar.com",
+				"Access-Control-Allow-Methods":     "GET",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			"OptionPassthrough",
+			Options{
+				OptionsPassthrough: true,
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			map[string]string{
+				"Vary":                         "Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET",
+			},
+		},
+		{
+			"NonPreflightOptions",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com",
+			},
+		},
+	}
+	for i := range cases {
+		tc := cases[i]
+		t.Run(tc.name, func(t *testing.T) {
 			s := New(tc.options)
 
 			var ctx fasthttp.RequestCtx
@@ -448,6 +784,342 @@ func TestSpec(t *testing.T) {
 	}
 }
 
+// TestStrict runs a shared table of spec cases against both the default (lax)
+// matching and Strict mode.
+func TestStrict(t *testing.T) {
+	cases := []struct {
+		name       string
+		options    Options
+		method     string
+		reqHeaders map[string]string
+		lax        map[string]string
+		strict     map[string]string
+	}{
+		{
+			"ExactOrigin",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com",
+			},
+		},
+		{
+			"OriginWithPort",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com:8080"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com:8080",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com:8080",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com:8080",
+			},
+		},
+		{
+			"IPv6Origin",
+			Options{
+				AllowedOrigins: []string{"http://[::1]:8080"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://[::1]:8080",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://[::1]:8080",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://[::1]:8080",
+			},
+		},
+		{
+			"UpperCaseRequestOrigin",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://FOOBAR.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://FOOBAR.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"UpperCaseAllowedOrigin",
+			Options{
+				AllowedOrigins: []string{"http://FooBar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"UpperCaseWildcardOrigin",
+			Options{
+				AllowedOrigins: []string{"http://*.bar.com"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://FOO.bar.com",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://FOO.bar.com",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"OriginWithTrailingSlash",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com/"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com/",
+			},
+			map[string]string{
+				"Vary":                        "Origin",
+				"Access-Control-Allow-Origin": "http://foobar.com/",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"OriginWithUserInfo",
+			Options{
+				AllowedOrigins: []string{"*"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://user@foobar.com",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"OriginWithInvalidPort",
+			Options{
+				AllowedOrigins: []string{"*"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "http://foobar.com:80a",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"NullOrigin",
+			Options{
+				AllowedOrigins: []string{"*"},
+			},
+			"GET",
+			map[string]string{
+				"Origin": "null",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+			map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			"AllowNullOrigin",
+			Options{
+				AllowedOrigins:  []string{"*"},
+				AllowNullOrigin: true,
+			},
+			"GET",
+			map[string]string{
+				"Origin": "null",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+			},
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+			},
+		},
+		{
+			"NormalizedMethod",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				AllowedMethods: []string{"DELETE"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "delete",
+			},
+			map[string]string{
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "DELETE",
+			},
+			map[string]string{
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "DELETE",
+			},
+		},
+		{
+			"NonNormalizedMethod",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				AllowedMethods: []string{"PATCH"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "patch",
+			},
+			map[string]string{
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "PATCH",
+			},
+			map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			"CustomMethodCase",
+			Options{
+				AllowedOrigins: []string{"http://foobar.com"},
+				AllowedMethods: []string{"propfind"},
+			},
+			"OPTIONS",
+			map[string]string{
+				"Origin":                        "http://foobar.com",
+				"Access-Control-Request-Method": "propfind",
+			},
+			map[string]string{
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "PROPFIND",
+			},
+			map[string]string{
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+				"Access-Control-Allow-Origin":  "http://foobar.com",
+				"Access-Control-Allow-Methods": "propfind",
+			},
+		},
+	}
+	for i := range cases {
+		tc := cases[i]
+		for _, strict := range []bool{false, true} {
+			name, want := "Lax", tc.lax
+			if strict {
+				name, want = "Strict", tc.strict
+			}
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				options := tc.options
+				options.Strict = strict
+				s := New(options)
+
+				var ctx fasthttp.RequestCtx
+				ctx.Request.Header.SetMethod(tc.method)
+				ctx.Request.SetRequestURI("http://example.com/foo")
+
+				for name, value := range tc.reqHeaders {
+					ctx.Request.Header.Add(name, value)
+				}
+
+				s.Handler(testHandler)(&ctx)
+				assertHeaders(t, &ctx, want)
+			})
+		}
+	}
+}
+
+func TestPreflightMultipleRequestHeaders(t *testing.T) {
+	s := New(Options{
+		AllowedOrigins: []string{"http://foobar.com"},
+		AllowedHeaders: []string{"X-Header-1", "X-Header-2"},
+	})
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodOptions)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "http://foobar.com")
+	ctx.Request.Header.Add("Access-Control-Request-Method", "GET")
+	ctx.Request.Header.Add("Access-Control-Request-Headers", "x-header-1")
+	ctx.Request.Header.Add("Access-Control-Request-Headers", "x-header-2")
+
+	s.Handler(testHandler)(&ctx)
+
+	assertHeaders(t, &ctx, map[string]string{
+		"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		"Access-Control-Allow-Origin":  "http://foobar.com",
+		"Access-Control-Allow-Methods": "GET",
+		"Access-Control-Allow-Headers": "X-Header-1, X-Header-2",
+	})
+}
+
+func TestPreflightTooManyRequestHeaders(t *testing.T) {
+	s := New(Options{
+		AllowedOrigins: []string{"http://foobar.com"},
+		AllowedHeaders: []string{"*"},
+	})
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodOptions)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "http://foobar.com")
+	ctx.Request.Header.Add("Access-Control-Request-Method", "GET")
+	for i := 0; i <= maxRequestHeaders; i++ {
+		ctx.Request.Header.Add("Access-Control-Request-Headers", "X-Header")
+	}
+
+	s.Handler(testHandler)(&ctx)
+
+	assertHeaders(t, &ctx, map[string]string{
+		"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+	})
+}
+
 func TestDebug(t *testing.T) {
 	s := New(Options{
 		Debug: true,
@@ -458,6 +1130,47 @@ func TestDebug(t *testing.T) {
 	}
 }
 
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, a ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, a...))
+}
+
+func (l *testLogger) contains(s string) bool {
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDebugDeniedOrigin(t *testing.T) {
+	s := New(Options{
+		AllowedOrigins: []string{"http://*.bar.com"},
+		DeniedOrigins:  []string{"http://legacy.bar.com"},
+	})
+	l := &testLogger{}
+	s.Log = l
+
+	for _, origin := range []string{"http://legacy.bar.com", "http://foo.baz.com"} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(http.MethodGet)
+		ctx.Request.SetRequestURI("http://example.com/foo")
+		ctx.Request.Header.Add("Origin", origin)
+		s.Handler(testHandler)(&ctx)
+	}
+
+	if !l.contains("origin 'http://legacy.bar.com' denied by DeniedOrigins") {
+		t.Errorf("denied origin not logged: %q", l.lines)
+	}
+	if !l.contains("origin 'http://foo.baz.com' not allowed by AllowedOrigins") {
+		t.Errorf("not allowed origin not logged: %q", l.lines)
+	}
+}
+
 func TestDefault(t *testing.T) {
 	s := Default()
 	if s.Log != nil {
@@ -558,3 +1271,382 @@ func TestIsMethodAllowedReturnsTrueWithOptions(t *testing.T) {
 		t.Error("IsMethodAllowed should return true when c.allowedMethods is nil.")
 	}
 }
+
+func TestValidate(t *testing.T) {
+	yes, no := true, false
+	cases := []struct {
+		name    string
+		options Options
+		valid   bool
+	}{
+		{"Empty", Options{}, true},
+		{"Site", Options{AllowedOrigins: []string{"site:example.co.uk"}}, true},
+		{"PublicSuffix", Options{AllowedOrigins: []string{"site:co.uk"}}, false},
+		{"DeniedPublicSuffix", Options{DeniedOrigins: []string{"site:co.uk"}}, false},
+		{"RulePublicSuffix", Options{OriginRules: []OriginRule{{Origins: []string{"site:co.uk"}}}}, false},
+		{"CIDRs", Options{AllowedOriginCIDRs: []string{"10.0.0.0/8", "fd00::/8"}}, true},
+		{"InvalidCIDR", Options{AllowedOriginCIDRs: []string{"10.0.0.0"}}, false},
+		{"Extensions", Options{AllowedExtensions: map[string][]string{"chrome-extension": {"abcdef"}}}, true},
+		{"ExtensionWebScheme", Options{AllowedExtensions: map[string][]string{"https": {"foo.com"}}}, false},
+		{"ExtensionInvalidID", Options{AllowedExtensions: map[string][]string{"moz-extension": {"*"}}}, false},
+		{"LoopbackCredentials", Options{AllowLoopback: true, AllowCredentials: true}, true},
+		{"StrictLoopbackCredentials", Options{AllowLoopback: true, AllowCredentials: true, Strict: true}, false},
+		{"StrictCIDRsCredentials", Options{AllowedOriginCIDRs: []string{"10.0.0.0/8"}, AllowCredentials: true, Strict: true}, false},
+		{
+			"StrictLoopbackPolicyCredentials",
+			Options{AllowLoopback: true, Strict: true, OriginPolicies: map[string]OriginPolicy{"http://localhost:3000": {AllowCredentials: &yes}}},
+			false,
+		},
+		{
+			"StrictCIDRsPolicyCredentials",
+			Options{AllowedOriginCIDRs: []string{"10.0.0.0/8"}, Strict: true, OriginPolicies: map[string]OriginPolicy{"http://foobar.com": {AllowCredentials: &yes}}},
+			false,
+		},
+		{
+			"StrictLoopbackPolicyNoCredentials",
+			Options{AllowLoopback: true, Strict: true, OriginPolicies: map[string]OriginPolicy{"http://localhost:3000": {AllowCredentials: &no}}},
+			true,
+		},
+		{
+			"StrictLoopbackCredentialsOverride",
+			Options{AllowLoopback: true, AllowCredentials: true, Strict: true, AllowPrivateNetworkCredentials: true},
+			true,
+		},
+		{"PreflightStatuses", Options{PreflightSuccessStatus: 200, PreflightFailureStatus: 403}, true},
+		{"PreflightSuccessStatus", Options{PreflightSuccessStatus: 403}, false},
+		{"PreflightFailureStatus", Options{PreflightFailureStatus: 600}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.options.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestNewPanicsOnInvalidOptions(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New should panic on a public suffix site")
+		}
+	}()
+	New(Options{AllowedOrigins: []string{"site:co.uk"}})
+}
+
+func TestPrivateNetworkOrigins(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		origin  string
+		allowed bool
+		reason  string
+	}{
+		{"Loopback", Options{AllowLoopback: true}, "http://localhost:3000", true, "AllowLoopback"},
+		{"LoopbackIPv6", Options{AllowLoopback: true}, "http://[::1]:8080", true, "AllowLoopback"},
+		{"LoopbackNoDefaultAll", Options{AllowLoopback: true}, "http://foo.com", false, "AllowedOrigins"},
+		{"LoopbackAndAllowedOrigins", Options{AllowLoopback: true, AllowedOrigins: []string{"http://foo.com"}}, "http://foo.com", true, "AllowedOrigins"},
+		{"LoopbackDenied", Options{AllowLoopback: true, DeniedOrigins: []string{"http://localhost:6666"}}, "http://localhost:6666", false, "DeniedOrigins"},
+		{"CIDR", Options{AllowedOriginCIDRs: []string{"192.168.0.0/16"}}, "http://192.168.1.20:5173", true, "AllowedOriginCIDRs"},
+		{"CIDROutOfRange", Options{AllowedOriginCIDRs: []string{"192.168.0.0/16"}}, "http://10.0.0.1", false, "AllowedOrigins"},
+		{"StrictMalformed", Options{AllowLoopback: true, Strict: true}, "http://LOCALHOST:3000", false, "Strict (malformed origin)"},
+	}
+	for _, tc := range cases {
+		c := New(tc.options)
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(http.MethodGet)
+		d := c.checkOrigin(&ctx, []byte(tc.origin), []byte(http.MethodGet))
+		if d.allowed != tc.allowed || d.reason != tc.reason {
+			t.Errorf("%s: checkOrigin(%q) = %+v, want {allowed:%v reason:%s}", tc.name, tc.origin, d, tc.allowed, tc.reason)
+		}
+	}
+}
+
+func TestNonWebOrigins(t *testing.T) {
+	extensions := map[string][]string{
+		"chrome-extension": {"abcdefghijklmnopabcdefghijklmnop"},
+		"moz-extension":    {"2d5a6c7e-6f7b-4e3a-9d1c-0a1b2c3d4e5f"},
+	}
+	cases := []struct {
+		name    string
+		options Options
+		origin  string
+		allowed bool
+		reason  string
+	}{
+		{"NullDefault", Options{}, "null", false, "AllowNullOrigin"},
+		{"NullAllowedOriginsAll", Options{AllowedOrigins: []string{"*"}}, "null", false, "AllowNullOrigin"},
+		{"NullAllowed", Options{AllowNullOrigin: true}, "null", true, "AllowNullOrigin"},
+		{"NullDenied", Options{AllowNullOrigin: true, DeniedOrigins: []string{"null"}}, "null", false, "DeniedOrigins"},
+		{"NullAllowOriginFunc", Options{AllowOriginFunc: func(o []byte) bool { return true }}, "null", true, "AllowOriginFunc"},
+		{"NullRuleAll", Options{OriginRules: []OriginRule{{Origins: []string{"*"}}}}, "null", false, "AllowNullOrigin"},
+		{"NullRuleListed", Options{OriginRules: []OriginRule{{Name: "sandbox", Origins: []string{"null"}}}}, "null", true, `rule "sandbox"`},
+		{"NullRuleAllowed", Options{AllowNullOrigin: true, OriginRules: []OriginRule{{Origins: []string{"*"}}}}, "null", true, "AllowNullOrigin"},
+		{"NullListed", Options{AllowedOrigins: []string{"http://foobar.com", "null"}}, "null", true, "AllowedOrigins"},
+		{"Chrome", Options{AllowedExtensions: extensions}, "chrome-extension://abcdefghijklmnopabcdefghijklmnop", true, "AllowedExtensions"},
+		{"Firefox", Options{AllowedExtensions: extensions}, "moz-extension://2d5a6c7e-6f7b-4e3a-9d1c-0a1b2c3d4e5f", true, "AllowedExtensions"},
+		{"OtherExtension", Options{AllowedExtensions: extensions}, "chrome-extension://ponmlkjihgfedcbaponmlkjihgfedcba", false, "AllowedOrigins"},
+		{"ExtensionIDOtherBrowser", Options{AllowedExtensions: extensions}, "moz-extension://abcdefghijklmnopabcdefghijklmnop", false, "AllowedOrigins"},
+		{"ExtensionNotAllOrigins", Options{AllowedExtensions: extensions}, "https://foo.com", false, "AllowedOrigins"},
+		{"Capacitor", Options{AllowedOrigins: []string{"capacitor://localhost"}}, "capacitor://localhost", true, "AllowedOrigins"},
+		{"CapacitorStrict", Options{AllowedOrigins: []string{"capacitor://localhost"}, Strict: true}, "capacitor://localhost", true, "AllowedOrigins"},
+	}
+	for _, tc := range cases {
+		c := New(tc.options)
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(http.MethodGet)
+		d := c.checkOrigin(&ctx, []byte(tc.origin), []byte(http.MethodGet))
+		if d.allowed != tc.allowed || d.reason != tc.reason {
+			t.Errorf("%s: checkOrigin(%q) = %+v, want {allowed:%v reason:%s}", tc.name, tc.origin, d, tc.allowed, tc.reason)
+		}
+	}
+}
+
+func resetHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Reset()
+	ctx.Response.Header.Set("X-Reset", "1")
+	ctx.SetStatusCode(http.StatusTeapot)
+}
+
+func TestReapplyAfterHandler(t *testing.T) {
+	options := Options{
+		AllowedOrigins:   []string{"http://foobar.com"},
+		ExposedHeaders:   []string{"X-Reset"},
+		AllowCredentials: true,
+	}
+
+	ctx := actualCtx("http://foobar.com")
+	New(options).Handler(resetHandler)(ctx)
+	assertHeaders(t, ctx, map[string]string{})
+
+	options.ReapplyAfterHandler = true
+	expected := map[string]string{
+		"Vary":                             "Origin",
+		"Access-Control-Allow-Origin":      "http://foobar.com",
+		"Access-Control-Expose-Headers":    "X-Reset",
+		"Access-Control-Allow-Credentials": "true",
+	}
+	for name, h := range map[string]fasthttp.RequestHandler{"Reset": resetHandler, "NoReset": testHandler} {
+		ctx = actualCtx("http://foobar.com")
+		New(options).Handler(h)(ctx)
+		assertHeaders(t, ctx, expected)
+		if name == "Reset" && ctx.Response.StatusCode() != http.StatusTeapot {
+			t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), http.StatusTeapot)
+		}
+	}
+}
+
+func panicHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("X-Partial", "1")
+	panic("boom")
+}
+
+func TestRecoverPanics(t *testing.T) {
+	c := New(Options{
+		AllowedOrigins:   []string{"http://foobar.com"},
+		AllowCredentials: true,
+		RecoverPanics:    true,
+	})
+	l := &testLogger{}
+	c.Log = l
+
+	ctx := actualCtx("http://foobar.com")
+	c.Handler(panicHandler)(ctx)
+	if ctx.Response.StatusCode() != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), http.StatusInternalServerError)
+	}
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                             "Origin",
+		"Access-Control-Allow-Origin":      "http://foobar.com",
+		"Access-Control-Allow-Credentials": "true",
+	})
+	if got := string(ctx.Response.Header.Peek("X-Partial")); got != "" {
+		t.Errorf("X-Partial = %q, the partial response should be discarded", got)
+	}
+	if !l.contains("panic serving http://example.com/foo: boom") {
+		t.Errorf("panic not logged: %q", l.lines)
+	}
+
+	// Requests that don't panic are untouched
+	ctx = actualCtx("http://foobar.com")
+	c.Handler(testHandler)(ctx)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), http.StatusOK)
+	}
+}
+
+func TestRepanic(t *testing.T) {
+	handler := New(Options{RecoverPanics: true, Repanic: true}).Handler(panicHandler)
+	ctx := actualCtx("http://foobar.com")
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the handler panic", r)
+		}
+		if ctx.Response.StatusCode() != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), http.StatusInternalServerError)
+		}
+		assertHeaders(t, ctx, map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		})
+	}()
+	handler(ctx)
+}
+
+func TestPreflightExtras(t *testing.T) {
+	options := Options{
+		AllowedOrigins:           []string{"http://foobar.com"},
+		AllowedMethods:           []string{"GET", "PUT"},
+		MaxAge:                   10,
+		PreflightCacheControl:    true,
+		PreflightCDNCacheControl: true,
+		PreflightSurrogateKey:    "cors preflight",
+		PreflightAllowHeader:     true,
+		OriginPolicies: map[string]OriginPolicy{
+			"http://baz.com": {AllowedMethods: []string{"*"}, MaxAge: new(int)},
+		},
+	}
+	options.AllowedOrigins = append(options.AllowedOrigins, "http://baz.com")
+
+	for _, size := range []int{0, 16} {
+		options.PreflightCacheSize = size
+		handler := New(options).Handler(testHandler)
+
+		ctx := preflightCtx("http://foobar.com", "PUT", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			"Access-Control-Allow-Origin":  "http://foobar.com",
+			"Access-Control-Allow-Methods": "PUT",
+			"Access-Control-Max-Age":       "10",
+			"Cache-Control":                "max-age=10",
+			"CDN-Cache-Control":            "max-age=10",
+			"Surrogate-Key":                "cors preflight",
+			"Allow":                        "GET, PUT, OPTIONS",
+			"Content-Length":               "0",
+		})
+
+		ctx = preflightCtx("http://baz.com", "DELETE", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			"Access-Control-Allow-Origin":  "http://baz.com",
+			"Access-Control-Allow-Methods": "*",
+			"Cache-Control":                "no-store",
+			"CDN-Cache-Control":            "no-store",
+			"Surrogate-Key":                "cors preflight",
+			"Content-Length":               "0",
+		})
+
+		ctx = preflightCtx("http://barbaz.com", "PUT", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":              "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			"Cache-Control":     "no-store",
+			"CDN-Cache-Control": "no-store",
+			"Surrogate-Key":     "cors preflight",
+			"Content-Length":    "0",
+		})
+	}
+}
+
+func TestPreflightStatus(t *testing.T) {
+	passthrough := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(http.StatusMethodNotAllowed)
+	}
+	cases := []struct {
+		name     string
+		options  Options
+		origin   string
+		wantCode int
+	}{
+		{"DefaultSuccess", Options{}, "http://foobar.com", http.StatusNoContent},
+		{"DefaultFailure", Options{}, "http://barbaz.com", http.StatusNoContent},
+		{"Success", Options{PreflightSuccessStatus: http.StatusOK}, "http://foobar.com", http.StatusOK},
+		{"FailureFollowsSuccess", Options{PreflightSuccessStatus: http.StatusOK}, "http://barbaz.com", http.StatusOK},
+		{"Failure", Options{PreflightFailureStatus: http.StatusForbidden}, "http://barbaz.com", http.StatusForbidden},
+		{"FailureOnSuccess", Options{PreflightFailureStatus: http.StatusForbidden}, "http://foobar.com", http.StatusNoContent},
+		{"PassthroughRejected", Options{OptionsPassthroughRejected: true}, "http://barbaz.com", http.StatusMethodNotAllowed},
+		{"PassthroughRejectedSuccess", Options{OptionsPassthroughRejected: true}, "http://foobar.com", http.StatusNoContent},
+		{"Passthrough", Options{OptionsPassthrough: true}, "http://foobar.com", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.options.AllowedOrigins = []string{"http://foobar.com"}
+			ctx := preflightCtx(tc.origin, "GET", "")
+			New(tc.options).Handler(passthrough)(ctx)
+			if code := ctx.Response.StatusCode(); code != tc.wantCode {
+				t.Errorf("status = %d, want %d", code, tc.wantCode)
+			}
+			want := ""
+			if tc.origin == "http://foobar.com" {
+				want = tc.origin
+			}
+			if got := joinHeaderValues(ctx, "Access-Control-Allow-Origin"); got != want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSkipSameOrigin(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		origin  string
+		want    map[string]string
+	}{
+		{
+			"SameOrigin",
+			Options{AllowedOrigins: []string{"http://example.com", "http://foobar.com"}, SkipSameOrigin: true},
+			"http://example.com",
+			map[string]string{"Vary": "Origin"},
+		},
+		{
+			"CrossOrigin",
+			Options{AllowedOrigins: []string{"http://example.com", "http://foobar.com"}, SkipSameOrigin: true},
+			"http://foobar.com",
+			map[string]string{"Vary": "Origin", "Access-Control-Allow-Origin": "http://foobar.com"},
+		},
+		{
+			"SameOriginNotSkipped",
+			Options{AllowedOrigins: []string{"http://example.com"}},
+			"http://example.com",
+			map[string]string{"Vary": "Origin", "Access-Control-Allow-Origin": "http://example.com"},
+		},
+		{
+			"SameOriginAnyOrigin",
+			Options{SkipSameOrigin: true},
+			"http://example.com",
+			map[string]string{"Vary": "Origin"},
+		},
+		{
+			"CrossOriginAnyOrigin",
+			Options{SkipSameOrigin: true},
+			"http://foobar.com",
+			map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := actualCtx(tc.origin)
+			ctx.Request.Header.SetMethod(http.MethodPost)
+			New(tc.options).Handler(testHandler)(ctx)
+			assertHeaders(t, ctx, tc.want)
+		})
+	}
+}
+
+func TestSkipSameOriginDebug(t *testing.T) {
+	c := New(Options{SkipSameOrigin: true, TrustedProxies: []string{"10.0.0.0/8"}})
+	l := &testLogger{}
+	c.Log = l
+	ctx := remoteCtx("POST", "http://backend:8080/foo", "10.0.0.1", map[string]string{
+		"Origin":            "https://example.com",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "example.com",
+	})
+	c.Handler(testHandler)(ctx)
+	assertHeaders(t, ctx, map[string]string{"Vary": "Origin"})
+	if !l.contains("same-origin request from 'https://example.com'") {
+		t.Errorf("same-origin request not logged: %q", l.lines)
+	}
+}
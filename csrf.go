@@ -0,0 +1,62 @@
+package cors
+
+import (
+	"bytes"
+
+	"github.com/valyala/fasthttp"
+)
+
+// allowCSRF checks the requests using unsafe methods for Options.CSRFGuard: their Origin,
+// or the origin of their Referer when Origin is missing, must be same-origin or allowed.
+// A "*" allowed origin doesn't count, as it would let any site through.
+func (c *Cors) allowCSRF(ctx *fasthttp.RequestCtx) bool {
+	method := ctx.Request.Header.Method()
+	if isSafeMethod(method) {
+		return true
+	}
+
+	origin := ctx.Request.Header.Peek("Origin")
+	if len(origin) == 0 {
+		origin = refererOrigin(ctx.Request.Header.Peek("Referer"))
+	}
+	if len(origin) == 0 {
+		if c.Log != nil {
+			c.logf("  CSRF guard: %s request without Origin or Referer rejected", method)
+		}
+		return false
+	}
+	if c.isSameOrigin(ctx, origin) {
+		return true
+	}
+
+	decision := c.checkOriginExplicitly(ctx, origin, method)
+	if c.Log != nil && !decision.allowed {
+		c.logf("  CSRF guard: %s request from origin '%s' rejected, %s", method, origin, decision)
+	}
+	return decision.allowed
+}
+
+// isSafeMethod checks if a method is safe as defined by RFC 7231 section 4.2.1, i.e.
+// it shouldn't change the state of the server
+func isSafeMethod(method []byte) bool {
+	switch string(method) {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodOptions, fasthttp.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// refererOrigin returns the origin part of a Referer URL, nil if it has none
+func refererOrigin(referer []byte) []byte {
+	i := bytes.Index(referer, []byte("://"))
+	if i <= 0 {
+		return nil
+	}
+	for j := i + 3; j < len(referer); j++ {
+		switch referer[j] {
+		case '/', '?', '#':
+			return referer[:j]
+		}
+	}
+	return referer
+}
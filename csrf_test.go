@@ -0,0 +1,145 @@
+package cors
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// remoteCtx returns a request sent to uri from remoteIP
+func remoteCtx(method, uri, remoteIP string, headers map[string]string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	for name, value := range headers {
+		req.Header.Add(name, value)
+	}
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remoteIP), Port: 4321}, nil)
+	return &ctx
+}
+
+func TestCSRFGuard(t *testing.T) {
+	cases := []struct {
+		name     string
+		method   string
+		uri      string
+		remoteIP string
+		headers  map[string]string
+		allowed  bool
+	}{
+		{"SafeMethod", "GET", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "http://evil.com"}, true},
+		{"SafeMethodNoOrigin", "HEAD", "http://example.com/foo", "203.0.113.1", nil, true},
+		{"SameOrigin", "POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "http://example.com"}, true},
+		{"SameOriginPort", "POST", "http://example.com:8080/foo", "203.0.113.1", map[string]string{"Origin": "http://example.com:8080"}, true},
+		{"AllowedOrigin", "PUT", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "http://foobar.com"}, true},
+		{"CrossOrigin", "POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "http://evil.com"}, false},
+		{"NullOrigin", "POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "null"}, false},
+		{"SameOriginReferer", "POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Referer": "http://example.com/form?x=1"}, true},
+		{"AllowedReferer", "DELETE", "http://example.com/foo", "203.0.113.1", map[string]string{"Referer": "http://foobar.com"}, true},
+		{"CrossOriginReferer", "POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Referer": "http://evil.com/example.com"}, false},
+		{"OriginOverReferer", "POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "http://evil.com", "Referer": "http://example.com/"}, false},
+		{"NoOriginNoReferer", "POST", "http://example.com/foo", "203.0.113.1", nil, false},
+		{
+			"TrustedProxy",
+			"POST", "http://backend:8080/foo", "10.0.0.1",
+			map[string]string{"Origin": "https://example.com", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"},
+			true,
+		},
+		{
+			"TrustedProxyChain",
+			"POST", "http://backend:8080/foo", "10.0.0.1",
+			map[string]string{"Origin": "https://example.com", "X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "backend, example.com"},
+			true,
+		},
+		{
+			"SpoofedForwardedHost",
+			"POST", "http://backend:8080/foo", "10.0.0.1",
+			map[string]string{"Origin": "https://evil.com", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com, example.com"},
+			false,
+		},
+		{
+			"UntrustedProxy",
+			"POST", "http://backend:8080/foo", "203.0.113.1",
+			map[string]string{"Origin": "https://example.com", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"},
+			false,
+		},
+	}
+	options := Options{
+		AllowedOrigins: []string{"http://foobar.com"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+		CSRFGuard:      true,
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}
+	handler := New(options).Handler(testHandler)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := remoteCtx(tc.method, tc.uri, tc.remoteIP, tc.headers)
+			handler(ctx)
+			if code := ctx.Response.StatusCode(); (code != http.StatusForbidden) != tc.allowed {
+				t.Errorf("status = %d, want allowed %v", code, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestCSRFGuardWildcard(t *testing.T) {
+	for _, options := range []Options{
+		{CSRFGuard: true},
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true, AllowNullOrigin: true, CSRFGuard: true},
+	} {
+		handler := New(options).Handler(testHandler)
+		for _, origin := range []string{"http://evil.com", "null"} {
+			ctx := remoteCtx("POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": origin})
+			handler(ctx)
+			if code := ctx.Response.StatusCode(); code != http.StatusForbidden {
+				t.Errorf("%s: status = %d, want %d", origin, code, http.StatusForbidden)
+			}
+		}
+
+		ctx := remoteCtx("POST", "http://example.com/foo", "203.0.113.1", map[string]string{"Origin": "http://example.com"})
+		handler(ctx)
+		if code := ctx.Response.StatusCode(); code == http.StatusForbidden {
+			t.Errorf("same origin: status = %d, want allowed", code)
+		}
+	}
+}
+
+func TestCSRFGuardRejectHandler(t *testing.T) {
+	options := Options{
+		CSRFGuard: true,
+		AllowOriginFunc: func(origin []byte) bool {
+			return false
+		},
+		RejectHandler: func(ctx *fasthttp.RequestCtx) {
+			ctx.Error("cross-site request", http.StatusBadRequest)
+		},
+	}
+	ctx := actualCtx("http://evil.com")
+	ctx.Request.Header.SetMethod(http.MethodPost)
+	New(options).Handler(testHandler)(ctx)
+	if code := ctx.Response.StatusCode(); code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if body := string(ctx.Response.Body()); body != "cross-site request" {
+		t.Errorf("body = %q, want %q", body, "cross-site request")
+	}
+}
+
+func TestRefererOrigin(t *testing.T) {
+	cases := map[string]string{
+		"http://example.com/foo?bar": "http://example.com",
+		"https://example.com:8443":   "https://example.com:8443",
+		"https://example.com?q=/":    "https://example.com",
+		"https://example.com#frag":   "https://example.com",
+		"/relative":                  "",
+		"":                           "",
+	}
+	for referer, want := range cases {
+		if got := string(refererOrigin([]byte(referer))); got != want {
+			t.Errorf("refererOrigin(%q) = %q, want %q", referer, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cors
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+// ExposeMode selects how Access-Control-Expose-Headers is computed for actual requests
+type ExposeMode int
+
+const (
+	// ExposeStatic exposes the ExposedHeaders, writing the CORS headers of actual
+	// requests before the handler runs. This is the default.
+	ExposeStatic ExposeMode = iota
+	// ExposeNonSafelisted exposes the ExposedHeaders and all the response headers that
+	// aren't CORS-safelisted, once the handler returned.
+	ExposeNonSafelisted
+	// ExposePrefixes exposes the ExposedHeaders and the response headers starting with
+	// one of the ExposedHeaderPrefixes, once the handler returned.
+	ExposePrefixes
+	// ExposeCallback exposes the ExposedHeaders and the headers returned by
+	// ExposeHeadersFunc, called once the handler returned.
+	ExposeCallback
+)
+
+// isExposable checks if a response header may be exposed dynamically: CORS-safelisted
+// response headers are always readable, cookies never are, and CORS headers and Vary
+// are ours.
+func isExposable(key []byte) bool {
+	switch {
+	case equalFoldString(key, "Cache-Control"),
+		equalFoldString(key, "Content-Language"),
+		equalFoldString(key, "Content-Length"),
+		equalFoldString(key, "Content-Type"),
+		equalFoldString(key, "Expires"),
+		equalFoldString(key, "Last-Modified"),
+		equalFoldString(key, "Pragma"),
+		equalFoldString(key, "Set-Cookie"),
+		equalFoldString(key, "Set-Cookie2"),
+		equalFoldString(key, "Vary"):
+		return false
+	}
+	return !(len(key) >= len("Access-Control-") && equalFoldString(key[:len("Access-Control-")], "Access-Control-"))
+}
+
+// hasExposedPrefix checks if a response header starts with one of the exposed prefixes
+func (c *Cors) hasExposedPrefix(key []byte) bool {
+	for _, prefix := range c.exposedHeaderPrefixes {
+		if len(key) >= len(prefix) && equalFoldString(key[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendExposedHeaders appends the comma separated list of headers to expose for the
+// final response headers of ctx to dst, starting with the static ExposedHeaders of p.
+// ExposeHeadersFunc is only called for the response of ctx, not for replacement
+// responses, which may be written while the handler still runs.
+func (c *Cors) appendExposedHeaders(dst []byte, ctx *fasthttp.RequestCtx, headers *fasthttp.ResponseHeader, p *policy) []byte {
+	base := len(dst)
+	dst = append(dst, p.exposedHeadersValue...)
+	switch c.exposeMode {
+	case ExposeNonSafelisted, ExposePrefixes:
+		headers.VisitAll(func(key, value []byte) {
+			if !isExposable(key) || c.exposeMode == ExposePrefixes && !c.hasExposedPrefix(key) {
+				return
+			}
+			dst = appendExposedHeader(dst, base, key)
+		})
+	case ExposeCallback:
+		if c.exposeHeadersFunc != nil && headers == &ctx.Response.Header {
+			for _, h := range c.exposeHeadersFunc(ctx) {
+				dst = appendExposedHeader(dst, base, []byte(h))
+			}
+		}
+	}
+	return dst
+}
+
+// appendExposedHeader appends the canonical name of a header to the list starting at
+// dst[base:], unless it is already listed.
+func appendExposedHeader(dst []byte, base int, name []byte) []byte {
+	if len(name) == 0 || headerListContains(dst[base:], name) {
+		return dst
+	}
+	for _, b := range name {
+		if !isTokenChar(b) {
+			return dst
+		}
+	}
+	if len(dst) > base {
+		dst = append(dst, ", "...)
+	}
+	return appendCanonicalHeaderKey(dst, name)
+}
+
+// headerListContains checks if a comma separated list of headers contains name,
+// ignoring case
+func headerListContains(list, name []byte) bool {
+	for i := 0; ; {
+		token, next, err := nextHeaderToken(list, i)
+		if err != nil || token == nil {
+			return false
+		}
+		if equalFold(token, name) {
+			return true
+		}
+		i = next
+	}
+}
@@ -0,0 +1,127 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func rateLimitedHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("X-RateLimit-Limit", "100")
+	ctx.Response.Header.Set("X-RateLimit-Remaining", "99")
+	ctx.Response.Header.Set("Link", `</foo?page=2>; rel="next"`)
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.Header.SetCookie(&fasthttp.Cookie{})
+	ctx.SetBodyString("bar")
+}
+
+func actualCtx(origin string) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodGet)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", origin)
+	return &ctx
+}
+
+func TestExposeMode(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		handler fasthttp.RequestHandler
+		exposed string
+	}{
+		{
+			"Static",
+			Options{ExposedHeaders: []string{"X-Static"}},
+			rateLimitedHandler,
+			"X-Static",
+		},
+		{
+			"NonSafelisted",
+			Options{ExposedHeaders: []string{"X-Static", "link"}, ExposeMode: ExposeNonSafelisted},
+			rateLimitedHandler,
+			"X-Static, Link, X-Ratelimit-Limit, X-Ratelimit-Remaining",
+		},
+		{
+			"Prefixes",
+			Options{ExposeMode: ExposePrefixes, ExposedHeaderPrefixes: []string{"x-ratelimit-", "Cache-"}},
+			rateLimitedHandler,
+			"X-Ratelimit-Limit, X-Ratelimit-Remaining",
+		},
+		{
+			"Callback",
+			Options{
+				ExposeMode: ExposeCallback,
+				ExposeHeadersFunc: func(ctx *fasthttp.RequestCtx) []string {
+					if len(ctx.Response.Header.Peek("Link")) > 0 {
+						return []string{"link", "Invalid Header", "Link"}
+					}
+					return nil
+				},
+			},
+			rateLimitedHandler,
+			"Link",
+		},
+		{
+			"CallbackNothing",
+			Options{
+				ExposeMode:        ExposeCallback,
+				ExposeHeadersFunc: func(ctx *fasthttp.RequestCtx) []string { return nil },
+			},
+			testHandler,
+			"",
+		},
+		{
+			"Wildcard",
+			Options{ExposedHeaders: []string{"*"}, ExposeMode: ExposeNonSafelisted},
+			rateLimitedHandler,
+			"*",
+		},
+		{
+			"WildcardWithCredentials",
+			Options{ExposedHeaders: []string{"*"}, ExposeMode: ExposePrefixes, ExposedHeaderPrefixes: []string{"Link"}, AllowCredentials: true},
+			rateLimitedHandler,
+			"Link",
+		},
+	}
+	for _, tc := range cases {
+		ctx := actualCtx("http://foobar.com")
+		New(tc.options).Handler(tc.handler)(ctx)
+		if got := joinHeaderValues(ctx, "Access-Control-Expose-Headers"); got != tc.exposed {
+			t.Errorf("%s: Access-Control-Expose-Headers = %q, want %q", tc.name, got, tc.exposed)
+		}
+		if got := joinHeaderValues(ctx, "Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tc.name, got, "*")
+		}
+	}
+}
+
+func TestExposeModeKeepsHandlerHeaders(t *testing.T) {
+	handler := New(Options{
+		AllowedOrigins:   []string{"http://foobar.com"},
+		AllowCredentials: true,
+		ExposeMode:       ExposeNonSafelisted,
+	}).Handler(func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Add("Vary", "Accept-Encoding, origin")
+		ctx.Response.Header.Set("Access-Control-Expose-Headers", "X-Mine")
+		ctx.Response.Header.Set("X-Other", "1")
+	})
+
+	ctx := actualCtx("http://foobar.com")
+	handler(ctx)
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                             "Accept-Encoding, origin",
+		"Access-Control-Allow-Origin":      "http://foobar.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "X-Mine",
+	})
+
+	ctx = actualCtx("http://barbaz.com")
+	handler(ctx)
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                          "Accept-Encoding, origin",
+		"Access-Control-Expose-Headers": "X-Mine",
+	})
+}
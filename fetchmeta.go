@@ -0,0 +1,63 @@
+package cors
+
+import (
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+)
+
+// allowResourceIsolation checks a request against the resource isolation policy of
+// Options.ResourceIsolation, using the Fetch Metadata request headers: same-origin,
+// same-site and user-initiated requests are allowed, and so are cross-site navigations
+// and the cross-site requests of allowed origins. Without Fetch Metadata, the Origin
+// header must be same-origin or allowed when present. A "*" allowed origin doesn't count.
+func (c *Cors) allowResourceIsolation(ctx *fasthttp.RequestCtx) bool {
+	origin := ctx.Request.Header.Peek("Origin")
+	site := ctx.Request.Header.Peek("Sec-Fetch-Site")
+	switch {
+	case len(site) == 0:
+		// Browsers without Fetch Metadata, or non-browser clients
+		if len(origin) == 0 || c.isSameOrigin(ctx, origin) {
+			return true
+		}
+	case equalFoldString(site, "same-origin"), equalFoldString(site, "same-site"), equalFoldString(site, "none"):
+		return true
+	case isNavigation(ctx):
+		return true
+	case len(origin) == 0:
+		if c.Log != nil {
+			c.logf("  Resource isolation: cross-site %s request without origin rejected", ctx.Request.Header.Peek("Sec-Fetch-Mode"))
+		}
+		return false
+	}
+
+	method := ctx.Request.Header.Method()
+	if ctx.IsOptions() {
+		if requested := ctx.Request.Header.Peek("Access-Control-Request-Method"); len(requested) > 0 {
+			method = requested
+		}
+	}
+	decision := c.checkOriginExplicitly(ctx, origin, method)
+	if c.Log != nil && !decision.allowed {
+		c.logf("  Resource isolation: cross-site request from origin '%s' rejected, %s", origin, decision)
+	}
+	return decision.allowed
+}
+
+// isNavigation checks if a request is a top-level or nested navigation, which cross-site
+// pages may trigger, unless it loads an object or embed element
+func isNavigation(ctx *fasthttp.RequestCtx) bool {
+	if !ctx.IsGet() && !ctx.IsHead() {
+		return false
+	}
+	if !equalFoldString(ctx.Request.Header.Peek("Sec-Fetch-Mode"), "navigate") {
+		return false
+	}
+	dest := ctx.Request.Header.Peek("Sec-Fetch-Dest")
+	return !equalFoldString(dest, "object") && !equalFoldString(dest, "embed")
+}
+
+// defaultRejectHandler replies to rejected requests with a 403 Forbidden
+func defaultRejectHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Error(http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
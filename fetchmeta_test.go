@@ -0,0 +1,132 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestResourceIsolation(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		allowed bool
+	}{
+		{"NoMetadata", "GET", map[string]string{}, true},
+		{"NoMetadataSameOrigin", "POST", map[string]string{"Origin": "http://example.com"}, true},
+		{"NoMetadataAllowedOrigin", "POST", map[string]string{"Origin": "http://foobar.com"}, true},
+		{"NoMetadataCrossOrigin", "POST", map[string]string{"Origin": "http://evil.com"}, false},
+		{"NoMetadataHTTPSOrigin", "POST", map[string]string{"Origin": "https://example.com"}, false},
+		{"SameOrigin", "POST", map[string]string{"Sec-Fetch-Site": "same-origin", "Sec-Fetch-Mode": "cors"}, true},
+		{"SameSite", "POST", map[string]string{"Sec-Fetch-Site": "same-site", "Sec-Fetch-Mode": "cors", "Origin": "http://api.example.com"}, true},
+		{"UserInitiated", "GET", map[string]string{"Sec-Fetch-Site": "none", "Sec-Fetch-Mode": "navigate"}, true},
+		{
+			"CrossSiteNavigation",
+			"GET",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"},
+			true,
+		},
+		{
+			"CrossSitePostNavigation",
+			"POST",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document", "Origin": "http://evil.com"},
+			false,
+		},
+		{
+			"CrossSiteObject",
+			"GET",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "object"},
+			false,
+		},
+		{
+			"CrossSiteNoCors",
+			"GET",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "no-cors", "Sec-Fetch-Dest": "image"},
+			false,
+		},
+		{
+			"CrossSiteAllowedOrigin",
+			"GET",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Origin": "http://foobar.com"},
+			true,
+		},
+		{
+			"CrossSiteOrigin",
+			"GET",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Origin": "http://evil.com"},
+			false,
+		},
+		{
+			"CrossSiteDeniedOrigin",
+			"GET",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Origin": "http://legacy.foobar.com"},
+			false,
+		},
+		{
+			"CrossSitePreflight",
+			"OPTIONS",
+			map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Origin": "http://foobar.com", "Access-Control-Request-Method": "PUT"},
+			true,
+		},
+	}
+	options := Options{
+		AllowedOrigins:    []string{"http://foobar.com", "http://*.foobar.com"},
+		DeniedOrigins:     []string{"http://legacy.foobar.com"},
+		AllowedMethods:    []string{"GET", "POST", "PUT"},
+		ResourceIsolation: true,
+	}
+	handler := New(options).Handler(testHandler)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod(tc.method)
+			ctx.Request.SetRequestURI("http://example.com/foo")
+			for name, value := range tc.headers {
+				ctx.Request.Header.Add(name, value)
+			}
+			handler(&ctx)
+			if code := ctx.Response.StatusCode(); (code != http.StatusForbidden) != tc.allowed {
+				t.Errorf("status = %d, want allowed %v", code, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestResourceIsolationWildcard(t *testing.T) {
+	for _, options := range []Options{
+		{ResourceIsolation: true},
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true, ResourceIsolation: true},
+	} {
+		handler := New(options).Handler(testHandler)
+		for name, headers := range map[string]map[string]string{
+			"CrossSite":  {"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Origin": "http://evil.com"},
+			"NoMetadata": {"Origin": "http://evil.com"},
+		} {
+			ctx := remoteCtx("POST", "http://example.com/foo", "203.0.113.1", headers)
+			handler(ctx)
+			if code := ctx.Response.StatusCode(); code != http.StatusForbidden {
+				t.Errorf("%s: status = %d, want %d", name, code, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+func TestResourceIsolationRejectHandler(t *testing.T) {
+	options := Options{
+		ResourceIsolation: true,
+		RejectHandler: func(ctx *fasthttp.RequestCtx) {
+			ctx.SetStatusCode(http.StatusTeapot)
+		},
+	}
+	ctx := actualCtx("http://evil.com")
+	ctx.Request.Header.Set("Sec-Fetch-Site", "cross-site")
+	ctx.Request.Header.Set("Sec-Fetch-Mode", "no-cors")
+	ctx.Request.Header.Del("Origin")
+	New(options).Handler(testHandler)(ctx)
+	if code := ctx.Response.StatusCode(); code != http.StatusTeapot {
+		t.Errorf("status = %d, want %d", code, http.StatusTeapot)
+	}
+	assertHeaders(t, ctx, map[string]string{})
+}
@@ -0,0 +1,16 @@
+//go:build go1.18
+// +build go1.18
+
+package cors
+
+import "testing"
+
+func FuzzRequestHeaders(f *testing.F) {
+	for _, seed := range requestHeadersSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, list string) {
+		checkRequestHeaders(t, list)
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToASCII(t *testing.T) {
+	cases := map[string]string{
+		"com":            "com",
+		"рф":             "xn--p1ai",
+		"個人.hk":          "xn--gmqw5a.hk",
+		"bücher.example": "xn--bcher-kva.example",
+		"*.ελ":           "*.xn--qxam",
+	}
+	for rule, want := range cases {
+		got, err := toASCII(rule)
+		if err != nil || got != want {
+			t.Errorf("toASCII(%q) = %q, %v, want %q", rule, got, err, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	list := `// ===BEGIN ICANN DOMAINS===
+com
+
+// Comments and blank lines are skipped
+*.CK
+!www.ck
+рф extra fields are ignored
+`
+	rules, err := parse(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(rules, " "), "com *.ck !www.ck xn--p1ai"; got != want {
+		t.Errorf("parse() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package cors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// IsolationPolicy sets the cross-origin isolation headers, Cross-Origin-Resource-Policy,
+// Cross-Origin-Opener-Policy and Cross-Origin-Embedder-Policy, needed among others to
+// enable SharedArrayBuffer. Empty fields don't send the matching header.
+//
+//	handler := cors.IsolatedAppPolicy().Handler(app)
+type IsolationPolicy struct {
+	// ResourcePolicy is the Cross-Origin-Resource-Policy: same-site, same-origin or
+	// cross-origin.
+	ResourcePolicy string
+	// OpenerPolicy is the Cross-Origin-Opener-Policy: unsafe-none,
+	// same-origin-allow-popups, same-origin or noopener-allow-popups.
+	OpenerPolicy string
+	// EmbedderPolicy is the Cross-Origin-Embedder-Policy: unsafe-none, require-corp or
+	// credentialless.
+	EmbedderPolicy string
+	// OpenerPolicyReportOnly is the Cross-Origin-Opener-Policy-Report-Only, reporting
+	// the violations of a policy without enforcing it.
+	OpenerPolicyReportOnly string
+	// EmbedderPolicyReportOnly is the Cross-Origin-Embedder-Policy-Report-Only,
+	// reporting the violations of a policy without enforcing it.
+	EmbedderPolicyReportOnly string
+	// ReportTo is the name of the reporting endpoint receiving the violations of the
+	// opener and embedder policies.
+	ReportTo string
+	// ReportingEndpoints are sent as the Reporting-Endpoints header, mapping endpoint
+	// names to the URL receiving their reports.
+	ReportingEndpoints map[string]string
+}
+
+// IsolatedAppPolicy returns the policy of a cross-origin isolated application: its
+// documents can't be opened by or embed cross-origin documents, and its resources can
+// only be loaded by itself. It only works with IsolationPolicy.Handler: Options.Isolation
+// rejects its same-origin ResourcePolicy, so set it to same-site there.
+func IsolatedAppPolicy() IsolationPolicy {
+	return IsolationPolicy{
+		ResourcePolicy: "same-origin",
+		OpenerPolicy:   "same-origin",
+		EmbedderPolicy: "require-corp",
+	}
+}
+
+// PublicAssetPolicy returns the policy of public assets, such as the ones served by a
+// CDN, which may be loaded by any site, including cross-origin isolated ones.
+func PublicAssetPolicy() IsolationPolicy {
+	return IsolationPolicy{
+		ResourcePolicy: "cross-origin",
+	}
+}
+
+// Validate checks the values of the policy
+func (p IsolationPolicy) Validate() error {
+	checks := []struct {
+		header string
+		value  string
+		valid  []string
+	}{
+		{"Cross-Origin-Resource-Policy", p.ResourcePolicy, []string{"same-site", "same-origin", "cross-origin"}},
+		{"Cross-Origin-Opener-Policy", p.OpenerPolicy, openerPolicies},
+		{"Cross-Origin-Opener-Policy-Report-Only", p.OpenerPolicyReportOnly, openerPolicies},
+		{"Cross-Origin-Embedder-Policy", p.EmbedderPolicy, embedderPolicies},
+		{"Cross-Origin-Embedder-Policy-Report-Only", p.EmbedderPolicyReportOnly, embedderPolicies},
+	}
+	for _, check := range checks {
+		if check.value == "" {
+			continue
+		}
+		valid := false
+		for _, v := range check.valid {
+			valid = valid || check.value == v
+		}
+		if !valid {
+			return fmt.Errorf("cors: invalid %s %q", check.header, check.value)
+		}
+	}
+
+	if p.ReportTo != "" && !isEndpointName(p.ReportTo) {
+		return fmt.Errorf("cors: invalid reporting endpoint name %q", p.ReportTo)
+	}
+	for name, url := range p.ReportingEndpoints {
+		if !isEndpointName(name) {
+			return fmt.Errorf("cors: invalid reporting endpoint name %q", name)
+		}
+		if url == "" || strings.ContainsAny(url, "\"\\\r\n") {
+			return fmt.Errorf("cors: invalid URL %q for reporting endpoint %q", url, name)
+		}
+	}
+	return nil
+}
+
+var (
+	openerPolicies   = []string{"unsafe-none", "same-origin-allow-popups", "same-origin", "noopener-allow-popups"}
+	embedderPolicies = []string{"unsafe-none", "require-corp", "credentialless"}
+)
+
+// isEndpointName checks if name is a valid reporting endpoint name, a structured field
+// key as defined by RFC 8941 section 3.1.2
+func isEndpointName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		switch {
+		case b >= 'a' && b <= 'z', b == '*':
+		case i > 0 && (b >= '0' && b <= '9' || b == '_' || b == '-' || b == '.'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Handler writes the isolation headers to the responses of h. It panics if the policy is
+// invalid, see IsolationPolicy.Validate.
+func (p IsolationPolicy) Handler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if err := p.Validate(); err != nil {
+		panic(err)
+	}
+	headers := compileIsolation(p)
+	return func(ctx *fasthttp.RequestCtx) {
+		writeIsolation(&ctx.Response.Header, headers, false)
+		h(ctx)
+	}
+}
+
+// isolationHeader is a pre-rendered isolation header
+type isolationHeader struct {
+	key   string
+	value []byte
+}
+
+// compileIsolation renders the headers of a valid policy
+func compileIsolation(p IsolationPolicy) []isolationHeader {
+	var headers []isolationHeader
+	add := func(key, value string, report bool) {
+		if value == "" {
+			return
+		}
+		if report && p.ReportTo != "" {
+			value += `; report-to="` + p.ReportTo + `"`
+		}
+		headers = append(headers, isolationHeader{key, []byte(value)})
+	}
+	add("Cross-Origin-Resource-Policy", p.ResourcePolicy, false)
+	add("Cross-Origin-Opener-Policy", p.OpenerPolicy, true)
+	add("Cross-Origin-Opener-Policy-Report-Only", p.OpenerPolicyReportOnly, true)
+	add("Cross-Origin-Embedder-Policy", p.EmbedderPolicy, true)
+	add("Cross-Origin-Embedder-Policy-Report-Only", p.EmbedderPolicyReportOnly, true)
+
+	names := make([]string, 0, len(p.ReportingEndpoints))
+	for name := range p.ReportingEndpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	endpoints := make([]string, len(names))
+	for i, name := range names {
+		endpoints[i] = name + `="` + p.ReportingEndpoints[name] + `"`
+	}
+	add("Reporting-Endpoints", strings.Join(endpoints, ", "), false)
+	return headers
+}
+
+// writeIsolation writes the isolation headers to a response. When keep is true, the
+// headers already present are left untouched.
+func writeIsolation(headers *fasthttp.ResponseHeader, isolation []isolationHeader, keep bool) {
+	for _, h := range isolation {
+		setActualHeader(headers, keep, h.key, h.value)
+	}
+}
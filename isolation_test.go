@@ -0,0 +1,178 @@
+package cors
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+var isolationHeaders = []string{
+	"Cross-Origin-Resource-Policy",
+	"Cross-Origin-Opener-Policy",
+	"Cross-Origin-Opener-Policy-Report-Only",
+	"Cross-Origin-Embedder-Policy",
+	"Cross-Origin-Embedder-Policy-Report-Only",
+	"Reporting-Endpoints",
+}
+
+func assertIsolationHeaders(t *testing.T, ctx *fasthttp.RequestCtx, expHeaders map[string]string) {
+	t.Helper()
+	for _, name := range isolationHeaders {
+		if got, want := joinHeaderValues(ctx, name), expHeaders[name]; got != want {
+			t.Errorf("Response header %q = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestIsolationPolicyHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy IsolationPolicy
+		want   map[string]string
+	}{
+		{
+			"IsolatedApp",
+			IsolatedAppPolicy(),
+			map[string]string{
+				"Cross-Origin-Resource-Policy": "same-origin",
+				"Cross-Origin-Opener-Policy":   "same-origin",
+				"Cross-Origin-Embedder-Policy": "require-corp",
+			},
+		},
+		{
+			"PublicAsset",
+			PublicAssetPolicy(),
+			map[string]string{
+				"Cross-Origin-Resource-Policy": "cross-origin",
+			},
+		},
+		{
+			"ReportOnly",
+			IsolationPolicy{
+				ResourcePolicy:           "same-site",
+				OpenerPolicy:             "same-origin-allow-popups",
+				EmbedderPolicyReportOnly: "require-corp",
+				ReportTo:                 "coep",
+				ReportingEndpoints: map[string]string{
+					"coep":    "https://reports.example.com/coep",
+					"default": "/reports",
+				},
+			},
+			map[string]string{
+				"Cross-Origin-Resource-Policy":             "same-site",
+				"Cross-Origin-Opener-Policy":               `same-origin-allow-popups; report-to="coep"`,
+				"Cross-Origin-Embedder-Policy-Report-Only": `require-corp; report-to="coep"`,
+				"Reporting-Endpoints":                      `coep="https://reports.example.com/coep", default="/reports"`,
+			},
+		},
+		{"Empty", IsolationPolicy{}, map[string]string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := actualCtx("")
+			tc.policy.Handler(testHandler)(ctx)
+			assertIsolationHeaders(t, ctx, tc.want)
+		})
+	}
+}
+
+func TestIsolationPolicyValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy IsolationPolicy
+		valid  bool
+	}{
+		{"Empty", IsolationPolicy{}, true},
+		{"IsolatedApp", IsolatedAppPolicy(), true},
+		{"PublicAsset", PublicAssetPolicy(), true},
+		{"Credentialless", IsolationPolicy{EmbedderPolicy: "credentialless"}, true},
+		{"ResourcePolicy", IsolationPolicy{ResourcePolicy: "same-domain"}, false},
+		{"ResourcePolicyCase", IsolationPolicy{ResourcePolicy: "Same-Origin"}, false},
+		{"OpenerPolicy", IsolationPolicy{OpenerPolicy: "require-corp"}, false},
+		{"OpenerPolicyReportOnly", IsolationPolicy{OpenerPolicyReportOnly: "none"}, false},
+		{"EmbedderPolicy", IsolationPolicy{EmbedderPolicy: "same-origin"}, false},
+		{"EmbedderPolicyReportOnly", IsolationPolicy{EmbedderPolicyReportOnly: "none"}, false},
+		{"ReportTo", IsolationPolicy{OpenerPolicy: "same-origin", ReportTo: "coop-reports"}, true},
+		{"InvalidReportTo", IsolationPolicy{OpenerPolicy: "same-origin", ReportTo: `coop"`}, false},
+		{"UpperCaseEndpoint", IsolationPolicy{ReportingEndpoints: map[string]string{"Default": "/reports"}}, false},
+		{"EmptyEndpointURL", IsolationPolicy{ReportingEndpoints: map[string]string{"default": ""}}, false},
+		{"QuotedEndpointURL", IsolationPolicy{ReportingEndpoints: map[string]string{"default": `/"reports"`}}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.policy.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestIsolationPolicyHandlerPanicsOnInvalidPolicy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Handler should panic on an invalid policy")
+		}
+	}()
+	IsolationPolicy{OpenerPolicy: "none"}.Handler(testHandler)
+}
+
+func TestIsolation(t *testing.T) {
+	isolation := IsolatedAppPolicy()
+	isolation.ResourcePolicy = "same-site"
+	options := Options{
+		AllowedOrigins: []string{"http://foobar.com"},
+		Isolation:      &isolation,
+	}
+	want := map[string]string{
+		"Cross-Origin-Resource-Policy": "same-site",
+		"Cross-Origin-Opener-Policy":   "same-origin",
+		"Cross-Origin-Embedder-Policy": "require-corp",
+	}
+
+	for _, mode := range []ExposeMode{ExposeStatic, ExposeNonSafelisted} {
+		options.ExposeMode = mode
+		handler := New(options).Handler(testHandler)
+		for _, origin := range []string{"http://foobar.com", "http://barbaz.com", ""} {
+			ctx := actualCtx(origin)
+			handler(ctx)
+			assertIsolationHeaders(t, ctx, want)
+		}
+	}
+
+	// The headers written by the handler are kept
+	options.ExposeMode = ExposeNonSafelisted
+	ctx := actualCtx("http://foobar.com")
+	New(options).Handler(func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Set("Cross-Origin-Resource-Policy", "cross-origin")
+	})(ctx)
+	want["Cross-Origin-Resource-Policy"] = "cross-origin"
+	assertIsolationHeaders(t, ctx, want)
+}
+
+func TestIsolationValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		isolation IsolationPolicy
+		valid     bool
+	}{
+		{"SameSite", IsolationPolicy{ResourcePolicy: "same-site"}, true},
+		{"PublicAsset", PublicAssetPolicy(), true},
+		{"SameOrigin", IsolatedAppPolicy(), false},
+		{"Invalid", IsolationPolicy{EmbedderPolicy: "none"}, false},
+	}
+	for _, tc := range cases {
+		options := Options{AllowedOrigins: []string{"http://foobar.com"}, Isolation: &tc.isolation}
+		if err := options.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+
+	// The default AllowedOrigins behaves like an explicit "*"
+	isolation := IsolatedAppPolicy()
+	for _, options := range []Options{
+		{Isolation: &isolation},
+		{AllowedOrigins: []string{"*"}, Isolation: &isolation},
+	} {
+		if options.Validate() == nil {
+			t.Errorf("Validate() should reject same-origin with AllowedOrigins %q", options.AllowedOrigins)
+		}
+	}
+}
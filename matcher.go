@@ -0,0 +1,457 @@
+package cors
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// OriginMatcher matches the origin of cross-origin requests. Implementations must be
+// safe for concurrent use and must not retain the origin, which points to request
+// memory.
+type OriginMatcher interface {
+	Match(origin []byte) bool
+}
+
+// OriginMatcherFunc is an adapter to use ordinary functions as origin matchers
+type OriginMatcherFunc func(origin []byte) bool
+
+// Match calls f(origin)
+func (f OriginMatcherFunc) Match(origin []byte) bool {
+	return f(origin)
+}
+
+// exactOrigins matches a set of origins
+type exactOrigins struct {
+	strict  bool
+	origins map[string]struct{}
+}
+
+// ExactOrigins matches any of the given origins, ignoring case.
+func ExactOrigins(origins ...string) OriginMatcher {
+	return newExactOrigins(origins, false)
+}
+
+func newExactOrigins(origins []string, strict bool) *exactOrigins {
+	m := &exactOrigins{strict: strict, origins: make(map[string]struct{}, len(origins))}
+	for _, o := range origins {
+		if !strict {
+			o = strings.ToLower(o)
+		}
+		m.origins[o] = struct{}{}
+	}
+	return m
+}
+
+// Match implements the OriginMatcher interface
+func (m *exactOrigins) Match(origin []byte) bool {
+	if m.strict || !hasUpper(origin) {
+		_, ok := m.origins[string(origin)]
+		return ok
+	}
+
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+	*buf = appendLower(*buf, origin)
+	_, ok := m.origins[string(*buf)]
+	return ok
+}
+
+// wildcardOrigin matches origins with a pattern containing a single wildcard
+type wildcardOrigin struct {
+	strict bool
+	w      wildcard
+}
+
+// WildcardOrigin matches the origins matching pattern, ignoring case. The pattern may
+// contain a single wildcard (*) replacing 0 or more characters, i.e.
+// http://*.domain.com.
+func WildcardOrigin(pattern string) OriginMatcher {
+	if strings.IndexByte(pattern, '*') < 0 {
+		return newExactOrigins([]string{pattern}, false)
+	}
+	return newWildcardOrigin(pattern, false)
+}
+
+// newWildcardOrigin compiles a pattern containing a wildcard
+func newWildcardOrigin(pattern string, strict bool) *wildcardOrigin {
+	if !strict {
+		pattern = strings.ToLower(pattern)
+	}
+	// Split the origin in two: start and end string without the *
+	i := strings.IndexByte(pattern, '*')
+	return &wildcardOrigin{strict, wildcard{[]byte(pattern[0:i]), []byte(pattern[i+1:])}}
+}
+
+// Match implements the OriginMatcher interface
+func (m *wildcardOrigin) Match(origin []byte) bool {
+	if m.strict {
+		return m.w.match(origin)
+	}
+	return m.w.matchFold(origin)
+}
+
+// SuffixOrigin matches the origins ending with suffix, ignoring case, i.e.
+// ".domain.com" matches https://www.domain.com but not https://domain.com.
+func SuffixOrigin(suffix string) OriginMatcher {
+	return newWildcardOrigin("*"+suffix, false)
+}
+
+// RegexpOrigin matches the origins matching the regular expression. Note that the
+// expression should be anchored, and that unlike the other matchers it doesn't
+// ignore case unless asked to with the (?i) flag.
+func RegexpOrigin(re *regexp.Regexp) OriginMatcher {
+	return OriginMatcherFunc(re.Match)
+}
+
+// schemeOrigin matches origins using some schemes
+type schemeOrigin struct {
+	schemes [][]byte
+}
+
+// SchemeOrigin matches any origin using one of the given schemes, ignoring case, i.e.
+// SchemeOrigin("https") matches all the secure web origins.
+func SchemeOrigin(schemes ...string) OriginMatcher {
+	m := &schemeOrigin{}
+	for _, s := range schemes {
+		m.schemes = append(m.schemes, []byte(strings.ToLower(s)))
+	}
+	return m
+}
+
+// Match implements the OriginMatcher interface
+func (m *schemeOrigin) Match(origin []byte) bool {
+	scheme, _, _, ok := splitOrigin(origin)
+	if !ok {
+		return false
+	}
+	for _, s := range m.schemes {
+		if equalFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// portRangeOrigin matches an origin on a range of ports
+type portRangeOrigin struct {
+	scheme   []byte
+	host     []byte
+	from, to int
+}
+
+// PortRangeOrigin matches the given origin, ignoring case, on any port between from
+// and to, inclusive. The origin must not contain a port, i.e.
+// PortRangeOrigin("http://localhost", 3000, 3999). When the origin has no explicit
+// port, the default port of its scheme is checked against the range. An error is
+// returned if the origin can't be parsed or has a port, or if the range isn't within
+// 0-65535.
+func PortRangeOrigin(origin string, from, to int) (OriginMatcher, error) {
+	scheme, host, port, ok := splitOrigin([]byte(strings.ToLower(origin)))
+	if !ok || len(port) > 0 || strings.HasSuffix(origin, ":") {
+		return nil, fmt.Errorf("cors: invalid port range origin %q", origin)
+	}
+	if from < 0 || to > 65535 || from > to {
+		return nil, fmt.Errorf("cors: invalid port range %d-%d", from, to)
+	}
+	return &portRangeOrigin{scheme, host, from, to}, nil
+}
+
+// Match implements the OriginMatcher interface
+func (m *portRangeOrigin) Match(origin []byte) bool {
+	scheme, host, port, ok := splitOrigin(origin)
+	// An empty port after a colon is malformed, not the default port
+	if !ok || (len(port) == 0 && origin[len(origin)-1] == ':') {
+		return false
+	}
+	if !equalFold(m.scheme, scheme) || !equalFold(m.host, host) {
+		return false
+	}
+	p, ok := originPort(scheme, port)
+	return ok && p >= m.from && p <= m.to
+}
+
+// LoopbackOrigin matches the http and https origins of the loopback interface on any
+// port: localhost and its subdomains, 127.0.0.0/8 and [::1].
+func LoopbackOrigin() OriginMatcher {
+	return OriginMatcherFunc(isLoopbackOrigin)
+}
+
+func isLoopbackOrigin(origin []byte) bool {
+	scheme, host, _, ok := splitOrigin(origin)
+	if !ok || !(equalFoldString(scheme, "http") || equalFoldString(scheme, "https")) {
+		return false
+	}
+	if equalFoldString(host, "localhost") || hasSuffixFold(host, ".localhost") {
+		return true
+	}
+	if ip, ok := parseIPv4(host); ok {
+		return ip[0] == 127
+	}
+	if ip := parseIPv6(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return false
+}
+
+// cidrOrigin matches origins whose host is an IP address in some networks
+type cidrOrigin []*net.IPNet
+
+// CIDROrigin matches the http and https origins whose host is an IP address in one of
+// the given ranges, in CIDR notation, on any port, i.e.
+// CIDROrigin("192.168.0.0/16", "fd00::/8") matches http://192.168.1.20:3000. An error
+// is returned if a range can't be parsed.
+func CIDROrigin(cidrs ...string) (OriginMatcher, error) {
+	m := make(cidrOrigin, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("cors: invalid origin CIDR %q: %v", cidr, err)
+		}
+		m = append(m, network)
+	}
+	return m, nil
+}
+
+// Match implements the OriginMatcher interface
+func (m cidrOrigin) Match(origin []byte) bool {
+	scheme, host, _, ok := splitOrigin(origin)
+	if !ok || !(equalFoldString(scheme, "http") || equalFoldString(scheme, "https")) {
+		return false
+	}
+	var ip net.IP
+	ip4, ok := parseIPv4(host)
+	if ok {
+		ip = ip4[:]
+	} else if ip = parseIPv6(host); ip == nil {
+		return false
+	}
+	for _, network := range m {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyOrigin matches origins matched by any of its matchers
+type anyOrigin []OriginMatcher
+
+// Any matches the origins matched by any of the matchers.
+func Any(matchers ...OriginMatcher) OriginMatcher {
+	return anyOrigin(matchers)
+}
+
+// Match implements the OriginMatcher interface
+func (m anyOrigin) Match(origin []byte) bool {
+	for _, matcher := range m {
+		if matcher.Match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allOrigin matches origins matched by all of its matchers
+type allOrigin []OriginMatcher
+
+// All matches the origins matched by all the matchers.
+func All(matchers ...OriginMatcher) OriginMatcher {
+	return allOrigin(matchers)
+}
+
+// Match implements the OriginMatcher interface
+func (m allOrigin) Match(origin []byte) bool {
+	for _, matcher := range m {
+		if !matcher.Match(origin) {
+			return false
+		}
+	}
+	return true
+}
+
+// notOrigin matches origins not matched by its matcher
+type notOrigin struct {
+	m OriginMatcher
+}
+
+// Not matches the origins not matched by m.
+func Not(m OriginMatcher) OriginMatcher {
+	return notOrigin{m}
+}
+
+// Match implements the OriginMatcher interface
+func (m notOrigin) Match(origin []byte) bool {
+	return !m.m.Match(origin)
+}
+
+// anyOriginMatcher matches all origins
+var anyOriginMatcher = OriginMatcherFunc(func(origin []byte) bool {
+	return true
+})
+
+// compileOrigins compiles a list of patterns using the AllowedOrigins syntax: exact
+// origins, origins with a single wildcard, sites prefixed with "site:", or "*" to match
+// any origin, which is reported by all. Unless strict is set, matching is
+// case-insensitive. Invalid sites are skipped, Options.Validate reporting them. A nil
+// matcher is returned for an empty list.
+func compileOrigins(patterns []string, strict bool) (m OriginMatcher, all bool) {
+	var exact []string
+	var matchers anyOrigin
+	for _, origin := range patterns {
+		if origin == "*" {
+			// If "*" is present in the list, turn the whole list into a match all
+			return anyOriginMatcher, true
+		} else if strings.HasPrefix(origin, sitePrefix) {
+			if m, err := newSiteOrigin(origin[len(sitePrefix):], strict); err == nil {
+				matchers = append(matchers, m)
+			}
+		} else if strings.IndexByte(origin, '*') >= 0 {
+			matchers = append(matchers, newWildcardOrigin(origin, strict))
+		} else {
+			exact = append(exact, origin)
+		}
+	}
+	if len(exact) > 0 {
+		matchers = append(anyOrigin{newExactOrigins(exact, strict)}, matchers...)
+	}
+	switch len(matchers) {
+	case 0:
+		return nil, false
+	case 1:
+		return matchers[0], false
+	}
+	return matchers, false
+}
+
+// compileExtensions compiles the AllowedExtensions option, extension IDs indexed by
+// scheme, into a matcher of their origins. A nil matcher is returned for an empty map.
+func compileExtensions(extensions map[string][]string) (OriginMatcher, error) {
+	var origins []string
+	for scheme, ids := range extensions {
+		scheme = strings.ToLower(scheme)
+		if scheme == "" || scheme == "http" || scheme == "https" || strings.ContainsAny(scheme, ":/") {
+			return nil, fmt.Errorf("cors: invalid browser extension scheme %q", scheme)
+		}
+		for _, id := range ids {
+			if id == "" || strings.ContainsAny(id, ":/*") {
+				return nil, fmt.Errorf("cors: invalid %s extension ID %q", scheme, id)
+			}
+			origins = append(origins, scheme+"://"+id)
+		}
+	}
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	// Extension IDs are case-sensitive, only their scheme is normalized
+	return newExactOrigins(origins, true), nil
+}
+
+// splitOrigin splits a serialized origin into its scheme, host and port. The brackets
+// of IPv6 hosts are removed.
+func splitOrigin(origin []byte) (scheme, host, port []byte, ok bool) {
+	i := bytes.Index(origin, []byte("://"))
+	if i <= 0 {
+		return nil, nil, nil, false
+	}
+	scheme, host = origin[:i], origin[i+3:]
+	if len(host) > 0 && host[0] == '[' {
+		end := bytes.IndexByte(host, ']')
+		if end < 0 {
+			return nil, nil, nil, false
+		}
+		host, port = host[1:end], host[end+1:]
+		if len(port) > 0 && port[0] != ':' {
+			return nil, nil, nil, false
+		}
+	} else if j := bytes.IndexByte(host, ':'); j >= 0 {
+		host, port = host[:j], host[j:]
+	}
+	if len(host) == 0 {
+		return nil, nil, nil, false
+	}
+	if len(port) > 0 {
+		port = port[1:]
+	}
+	return scheme, host, port, true
+}
+
+// originPort returns the port of an origin, or the default port of its scheme
+func originPort(scheme, port []byte) (int, bool) {
+	if len(port) == 0 {
+		switch {
+		case equalFoldString(scheme, "http"):
+			return 80, true
+		case equalFoldString(scheme, "https"):
+			return 443, true
+		}
+		return 0, false
+	}
+	p := 0
+	for _, b := range port {
+		if b < '0' || b > '9' || p > 65535 {
+			return 0, false
+		}
+		p = p*10 + int(b-'0')
+	}
+	return p, p <= 65535
+}
+
+// parseIPv4 parses a dotted decimal IPv4 address without allocating
+func parseIPv4(b []byte) (ip [4]byte, ok bool) {
+	for i := 0; i < 4; i++ {
+		if i > 0 {
+			if len(b) == 0 || b[0] != '.' {
+				return ip, false
+			}
+			b = b[1:]
+		}
+		n, digits := 0, 0
+		for digits < len(b) && b[digits] >= '0' && b[digits] <= '9' {
+			n = n*10 + int(b[digits]-'0')
+			digits++
+			if n > 255 || digits > 3 {
+				return ip, false
+			}
+		}
+		if digits == 0 || digits > 1 && b[0] == '0' {
+			return ip, false
+		}
+		ip[i] = byte(n)
+		b = b[digits:]
+	}
+	return ip, len(b) == 0
+}
+
+// parseIPv6 parses an IPv6 address, returning nil if b isn't one
+func parseIPv6(b []byte) net.IP {
+	if bytes.IndexByte(b, ':') < 0 {
+		return nil
+	}
+	return net.ParseIP(string(b))
+}
+
+// hasUpper checks if b contains ASCII upper case letters
+func hasUpper(b []byte) bool {
+	for _, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// appendLower appends the ASCII lower case of b to dst
+func appendLower(dst, b []byte) []byte {
+	for _, c := range b {
+		dst = append(dst, lower(c))
+	}
+	return dst
+}
+
+// hasSuffixFold checks if b ends with suffix, ignoring ASCII case
+func hasSuffixFold(b []byte, suffix string) bool {
+	return len(b) >= len(suffix) && equalFoldString(b[len(b)-len(suffix):], suffix)
+}
@@ -0,0 +1,206 @@
+package cors
+
+import (
+	"regexp"
+	"testing"
+)
+
+func assertMatches(t *testing.T, name string, m OriginMatcher, match, noMatch []string) {
+	t.Helper()
+	for _, o := range match {
+		if !m.Match([]byte(o)) {
+			t.Errorf("%s should match %q", name, o)
+		}
+	}
+	for _, o := range noMatch {
+		if m.Match([]byte(o)) {
+			t.Errorf("%s should not match %q", name, o)
+		}
+	}
+}
+
+func TestExactOrigins(t *testing.T) {
+	assertMatches(t, "ExactOrigins", ExactOrigins("http://foo.com", "https://BAR.com:8443"),
+		[]string{"http://foo.com", "HTTP://FOO.COM", "https://bar.com:8443"},
+		[]string{"https://foo.com", "http://foo.com:80", "https://bar.com", "http://foo.co"})
+
+	assertMatches(t, "strict exactOrigins", newExactOrigins([]string{"http://foo.com"}, true),
+		[]string{"http://foo.com"},
+		[]string{"http://FOO.com"})
+}
+
+func TestWildcardOrigin(t *testing.T) {
+	assertMatches(t, "WildcardOrigin", WildcardOrigin("https://*.foo.com"),
+		[]string{"https://www.foo.com", "https://a.b.FOO.com"},
+		[]string{"https://foo.com", "http://www.foo.com", "https://www.foo.com:8443"})
+
+	assertMatches(t, "WildcardOrigin without wildcard", WildcardOrigin("https://foo.com"),
+		[]string{"https://foo.com"},
+		[]string{"https://foo.com.evil.com"})
+
+	assertMatches(t, "strict wildcardOrigin", newWildcardOrigin("https://*.foo.com", true),
+		[]string{"https://www.foo.com"},
+		[]string{"https://www.FOO.com"})
+}
+
+func TestSuffixOrigin(t *testing.T) {
+	assertMatches(t, "SuffixOrigin", SuffixOrigin(".foo.com"),
+		[]string{"https://www.foo.com", "http://a.b.foo.com"},
+		[]string{"https://foo.com", "https://evilfoo.com", "https://www.foo.com:8443"})
+}
+
+func TestRegexpOrigin(t *testing.T) {
+	assertMatches(t, "RegexpOrigin", RegexpOrigin(regexp.MustCompile(`^https://[a-z]+\.foo\.com$`)),
+		[]string{"https://www.foo.com"},
+		[]string{"https://www1.foo.com", "https://www.foo.com.evil.com"})
+}
+
+func TestSchemeOrigin(t *testing.T) {
+	assertMatches(t, "SchemeOrigin", SchemeOrigin("https", "Chrome-Extension"),
+		[]string{"https://foo.com", "HTTPS://foo.com:8443", "chrome-extension://abcdef"},
+		[]string{"http://foo.com", "https:foo.com", "null", "moz-extension://abcdef"})
+}
+
+func TestPortRangeOrigin(t *testing.T) {
+	m, err := PortRangeOrigin("http://localhost", 3000, 3999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatches(t, "PortRangeOrigin", m,
+		[]string{"http://localhost:3000", "http://LOCALHOST:3999"},
+		[]string{"http://localhost:2999", "http://localhost:4000", "http://localhost", "https://localhost:3000", "http://localhost:3x00",
+			"http://localhost:", "http://localhost:3000/", "http://localhost:003000000", "localhost:3000", "http://:3000"})
+
+	m, _ = PortRangeOrigin("https://foo.com", 443, 8443)
+	assertMatches(t, "PortRangeOrigin default port", m,
+		[]string{"https://foo.com", "https://foo.com:8443"},
+		[]string{"https://foo.com:80", "https://foo.com:"})
+
+	m, _ = PortRangeOrigin("http://[::1]", 8000, 9000)
+	assertMatches(t, "PortRangeOrigin IPv6", m,
+		[]string{"http://[::1]:8080"},
+		[]string{"http://[::1]:80", "http://[::2]:8080", "http://[::1]8080", "http://[::1"})
+
+	cases := []struct {
+		origin   string
+		from, to int
+	}{
+		{"http://localhost", 4000, 3000},
+		{"http://localhost", -1, 3000},
+		{"http://localhost", 3000, 65536},
+		{"http://localhost:3000", 3000, 3999},
+		{"http://localhost:", 3000, 3999},
+		{"localhost", 3000, 3999},
+		{"http://", 3000, 3999},
+	}
+	for _, tc := range cases {
+		if _, err := PortRangeOrigin(tc.origin, tc.from, tc.to); err == nil {
+			t.Errorf("PortRangeOrigin(%q, %d, %d) should fail", tc.origin, tc.from, tc.to)
+		}
+	}
+}
+
+func TestLoopbackOrigin(t *testing.T) {
+	assertMatches(t, "LoopbackOrigin", LoopbackOrigin(),
+		[]string{
+			"http://localhost", "http://localhost:3000", "https://app.localhost:8443",
+			"http://127.0.0.1:5173", "http://127.1.2.3", "http://[::1]:8080",
+		},
+		[]string{
+			"http://localhost.com", "http://127.0.0.1.evil.com", "http://128.0.0.1",
+			"http://[::2]", "chrome-extension://localhost", "null", "http://0127.0.0.1",
+		})
+}
+
+func TestCombinators(t *testing.T) {
+	m := All(SuffixOrigin(".foo.com"), Not(Any(ExactOrigins("https://legacy.foo.com"), SchemeOrigin("http"))))
+	assertMatches(t, "combinators", m,
+		[]string{"https://www.foo.com"},
+		[]string{"https://legacy.foo.com", "http://www.foo.com", "https://www.bar.com"})
+
+	assertMatches(t, "empty Any", Any(), nil, []string{"https://foo.com"})
+	assertMatches(t, "empty All", All(), []string{"https://foo.com"}, nil)
+}
+
+func TestCompileOrigins(t *testing.T) {
+	if m, all := compileOrigins(nil, false); m != nil || all {
+		t.Errorf("compileOrigins(nil) = %v, %v, want nil, false", m, all)
+	}
+	if m, all := compileOrigins([]string{"http://foo.com", "*"}, false); m == nil || !all {
+		t.Errorf("compileOrigins(*) = %v, %v, want a match all", m, all)
+	}
+
+	m, all := compileOrigins([]string{"http://foo.com", "https://*.bar.com", "http://baz.com"}, false)
+	if all {
+		t.Error("compileOrigins should not match all")
+	}
+	assertMatches(t, "compileOrigins", m,
+		[]string{"http://foo.com", "http://BAZ.com", "https://www.bar.com"},
+		[]string{"https://foo.com", "https://bar.com"})
+}
+
+func TestSplitOrigin(t *testing.T) {
+	cases := []struct {
+		origin, scheme, host, port string
+		ok                         bool
+	}{
+		{"http://foo.com", "http", "foo.com", "", true},
+		{"https://foo.com:8443", "https", "foo.com", "8443", true},
+		{"http://[::1]:8080", "http", "::1", "8080", true},
+		{"http://[::1]", "http", "::1", "", true},
+		{"http://[::1]x", "", "", "", false},
+		{"http://", "", "", "", false},
+		{"null", "", "", "", false},
+	}
+	for _, tc := range cases {
+		scheme, host, port, ok := splitOrigin([]byte(tc.origin))
+		if string(scheme) != tc.scheme || string(host) != tc.host || string(port) != tc.port || ok != tc.ok {
+			t.Errorf("splitOrigin(%q) = %q, %q, %q, %v", tc.origin, scheme, host, port, ok)
+		}
+	}
+}
+
+func TestParseIPv4(t *testing.T) {
+	for _, s := range []string{"127.0.0.1", "0.0.0.0", "255.255.255.255", "10.1.20.3"} {
+		if _, ok := parseIPv4([]byte(s)); !ok {
+			t.Errorf("%q should be a valid IPv4 address", s)
+		}
+	}
+	for _, s := range []string{"", "127.0.0", "127.0.0.1.", "256.0.0.1", "01.0.0.1", "1.2.3.4x", "1..2.3", "::1"} {
+		if _, ok := parseIPv4([]byte(s)); ok {
+			t.Errorf("%q should be an invalid IPv4 address", s)
+		}
+	}
+}
+
+func BenchmarkExactOrigins(b *testing.B) {
+	m := ExactOrigins("http://foo.com", "http://bar.com", "http://baz.com")
+	b.Run("lower", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.Match([]byte("http://baz.com"))
+		}
+	})
+	b.Run("upper", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.Match([]byte("http://BAZ.com"))
+		}
+	})
+}
+
+func TestCIDROrigin(t *testing.T) {
+	m, err := CIDROrigin("192.168.0.0/16", "10.0.0.0/8", "fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatches(t, "CIDROrigin", m,
+		[]string{"http://192.168.1.20:3000", "https://10.1.2.3", "http://[fd12::1]:8080", "http://[::ffff:10.0.0.1]"},
+		[]string{"http://192.169.0.1", "http://127.0.0.1", "http://[fe80::1]", "ftp://10.0.0.1", "http://10.0.0.1.evil.com", "http://lan.local", "null"})
+
+	for _, cidr := range []string{"192.168.0.0", "10.0.0.0/33", "lan"} {
+		if _, err := CIDROrigin(cidr); err == nil {
+			t.Errorf("CIDROrigin(%q) should fail", cidr)
+		}
+	}
+}
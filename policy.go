@@ -0,0 +1,212 @@
+package cors
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OriginPolicy overrides some options for the origins matching an OriginPolicies
+// pattern. Nil fields keep the value of the global options.
+type OriginPolicy struct {
+	// AllowedMethods replaces Options.AllowedMethods
+	AllowedMethods []string
+	// AllowedHeaders replaces Options.AllowedHeaders
+	AllowedHeaders []string
+	// ExposedHeaders replaces Options.ExposedHeaders
+	ExposedHeaders []string
+	// AllowCredentials replaces Options.AllowCredentials
+	AllowCredentials *bool
+	// MaxAge replaces Options.MaxAge
+	MaxAge *int
+}
+
+// policy holds the normalized settings of the responses sent to allowed origins
+type policy struct {
+	// Normalized list of allowed headers
+	allowedHeaders []string
+	// Set of allowed headers, indexed by canonical name
+	allowedHeadersSet map[string]struct{}
+	// Normalized list of allowed methods
+	allowedMethods []string
+	// Normalized list of exposed headers
+	exposedHeaders []string
+	// Pre-rendered Access-Control-Expose-Headers value
+	exposedHeadersValue []byte
+	maxAge              int
+	// Pre-rendered Access-Control-Max-Age value
+	maxAgeValue []byte
+	// Pre-rendered Cache-Control value of successful preflights
+	cacheControlValue []byte
+	// Pre-rendered Allow value of preflights, empty when all methods are allowed
+	allowValue []byte
+	// Set to true when allowed headers contains a "*"
+	allowedHeadersAll bool
+	// Set to true when allowed methods contains a "*"
+	allowedMethodsAll bool
+	// Set to true when exposed headers contains a "*"
+	exposedHeadersAll bool
+	allowCredentials  bool
+	strict            bool
+}
+
+// newPolicy normalizes the policy settings of options
+func newPolicy(options Options) policy {
+	p := policy{
+		allowCredentials: options.AllowCredentials,
+		maxAge:           options.MaxAge,
+		strict:           options.Strict,
+	}
+
+	// Allowed Headers
+	if len(options.AllowedHeaders) == 0 {
+		// Use sensible defaults
+		p.allowedHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}
+	} else {
+		// Origin is always appended as some browsers will always request for this header at preflight
+		p.allowedHeaders = convert(append(options.AllowedHeaders, "Origin"), http.CanonicalHeaderKey)
+		for _, h := range options.AllowedHeaders {
+			if h == "*" {
+				p.allowedHeadersAll = true
+				p.allowedHeaders = nil
+				break
+			}
+		}
+	}
+
+	p.allowedHeadersSet = make(map[string]struct{}, len(p.allowedHeaders))
+	for _, h := range p.allowedHeaders {
+		p.allowedHeadersSet[h] = struct{}{}
+	}
+
+	// Allowed Methods
+	if len(options.AllowedMethods) == 0 {
+		// Default is spec's "simple" methods
+		p.allowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+	} else {
+		if p.strict {
+			p.allowedMethods = convert(options.AllowedMethods, normalizeMethod)
+		} else {
+			p.allowedMethods = convert(options.AllowedMethods, strings.ToUpper)
+		}
+		for _, m := range options.AllowedMethods {
+			if m == "*" {
+				p.allowedMethodsAll = true
+				p.allowedMethods = nil
+				break
+			}
+		}
+	}
+
+	// Exposed Headers
+	p.exposedHeaders = []string{}
+	for _, h := range options.ExposedHeaders {
+		if h == "*" {
+			// "*" is only a wildcard for requests without credentials, so keep the
+			// explicit headers around for credentialed responses
+			p.exposedHeadersAll = true
+			continue
+		}
+		p.exposedHeaders = append(p.exposedHeaders, http.CanonicalHeaderKey(h))
+	}
+	if p.maxAge > 0 {
+		p.maxAgeValue = []byte(strconv.Itoa(p.maxAge))
+		p.cacheControlValue = []byte("max-age=" + strconv.Itoa(p.maxAge))
+	} else {
+		p.cacheControlValue = headerNoStore
+	}
+	if !p.allowedMethodsAll && len(p.allowedMethods) > 0 {
+		// Preflights themselves are always allowed
+		allow := append([]string(nil), p.allowedMethods...)
+		options := false
+		for _, m := range allow {
+			options = options || m == http.MethodOptions
+		}
+		if !options {
+			allow = append(allow, http.MethodOptions)
+		}
+		p.allowValue = []byte(strings.Join(allow, ", "))
+	}
+
+	if p.exposedHeadersAll && !p.allowCredentials {
+		p.exposedHeadersValue = headerWildcard
+	} else if len(p.exposedHeaders) > 0 {
+		p.exposedHeadersValue = []byte(strings.Join(p.exposedHeaders, ", "))
+	}
+
+	return p
+}
+
+// originPolicy is a policy applying to the origins matching a pattern
+type originPolicy struct {
+	pattern string
+	origins OriginMatcher
+	policy  *policy
+}
+
+// compileOriginPolicies merges the OriginPolicies with the global options, sorting them
+// in matching order: exact origins first, then the longest patterns.
+func compileOriginPolicies(options Options) []originPolicy {
+	patterns := make([]string, 0, len(options.OriginPolicies))
+	for pattern := range options.OriginPolicies {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if exactA, exactB := isExactOrigin(a), isExactOrigin(b); exactA != exactB {
+			return exactA
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+
+	policies := make([]originPolicy, 0, len(patterns))
+	for _, pattern := range patterns {
+		overrides := options.OriginPolicies[pattern]
+		merged := options
+		if overrides.AllowedMethods != nil {
+			merged.AllowedMethods = overrides.AllowedMethods
+		}
+		if overrides.AllowedHeaders != nil {
+			merged.AllowedHeaders = overrides.AllowedHeaders
+		}
+		if overrides.ExposedHeaders != nil {
+			merged.ExposedHeaders = overrides.ExposedHeaders
+		}
+		if overrides.AllowCredentials != nil {
+			merged.AllowCredentials = *overrides.AllowCredentials
+		}
+		if overrides.MaxAge != nil {
+			merged.MaxAge = *overrides.MaxAge
+		}
+
+		p := newPolicy(merged)
+		origins, _ := compileOrigins([]string{pattern}, options.Strict)
+		if origins == nil {
+			continue
+		}
+		policies = append(policies, originPolicy{pattern: pattern, origins: origins, policy: &p})
+	}
+	return policies
+}
+
+// isExactOrigin checks if an AllowedOrigins pattern matches a single origin
+func isExactOrigin(pattern string) bool {
+	return !strings.HasPrefix(pattern, sitePrefix) && strings.IndexByte(pattern, '*') < 0
+}
+
+// policyFor returns the policy applying to an allowed origin
+func (c *Cors) policyFor(origin []byte) *policy {
+	for i := range c.originPolicies {
+		if op := &c.originPolicies[i]; op.origins.Match(origin) {
+			if c.Log != nil {
+				c.logf("  Origin policy '%s' applies", op.pattern)
+			}
+			return op.policy
+		}
+	}
+	return &c.policy
+}
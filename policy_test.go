@@ -0,0 +1,163 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestOriginPolicies(t *testing.T) {
+	yes, maxAge := true, 3600
+	options := Options{
+		AllowedOrigins: []string{"https://*.partner.com", "https://other.com"},
+		AllowedMethods: []string{"GET", "POST", "PUT"},
+		ExposedHeaders: []string{"X-Global"},
+		OriginPolicies: map[string]OriginPolicy{
+			"https://*.partner.com": {
+				AllowCredentials: &yes,
+				MaxAge:           &maxAge,
+			},
+			"https://readonly.partner.com": {
+				AllowedMethods: []string{"GET"},
+				ExposedHeaders: []string{"X-Count", "X-Page"},
+			},
+			"https://unlisted.com": {
+				AllowCredentials: &yes,
+			},
+		},
+	}
+
+	for _, size := range []int{0, 10} {
+		options.PreflightCacheSize = size
+		handler := New(options).Handler(testHandler)
+
+		ctx := preflightCtx("https://www.partner.com", "PUT", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			"Access-Control-Allow-Origin":      "https://www.partner.com",
+			"Access-Control-Allow-Methods":     "PUT",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Max-Age":           "3600",
+		})
+
+		// The exact origin wins over the wildcard, and only overrides the methods
+		ctx = preflightCtx("https://readonly.partner.com", "PUT", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		})
+
+		ctx = preflightCtx("https://other.com", "PUT", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			"Access-Control-Allow-Origin":  "https://other.com",
+			"Access-Control-Allow-Methods": "PUT",
+		})
+
+		// Policies don't allow origins
+		ctx = preflightCtx("https://unlisted.com", "GET", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		})
+	}
+
+	handler := New(options).Handler(testHandler)
+	for origin, expected := range map[string]map[string]string{
+		"https://readonly.partner.com": {
+			"Vary":                          "Origin",
+			"Access-Control-Allow-Origin":   "https://readonly.partner.com",
+			"Access-Control-Expose-Headers": "X-Count, X-Page",
+		},
+		"https://www.partner.com": {
+			"Vary":                             "Origin",
+			"Access-Control-Allow-Origin":      "https://www.partner.com",
+			"Access-Control-Expose-Headers":    "X-Global",
+			"Access-Control-Allow-Credentials": "true",
+		},
+		"https://other.com": {
+			"Vary":                          "Origin",
+			"Access-Control-Allow-Origin":   "https://other.com",
+			"Access-Control-Expose-Headers": "X-Global",
+		},
+	} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(http.MethodGet)
+		ctx.Request.SetRequestURI("http://example.com/foo")
+		ctx.Request.Header.Add("Origin", origin)
+		handler(&ctx)
+		assertHeaders(t, &ctx, expected)
+	}
+}
+
+func TestOriginPoliciesCredentialsWithWildcard(t *testing.T) {
+	yes := true
+	options := Options{
+		AllowedOrigins: []string{"*"},
+		OriginPolicies: map[string]OriginPolicy{
+			"http://a.com": {AllowCredentials: &yes},
+		},
+	}
+
+	for _, size := range []int{0, 10} {
+		options.PreflightCacheSize = size
+		handler := New(options).Handler(testHandler)
+
+		// The origin is never reflected for "*", browsers reject credentialed reads
+		ctx := preflightCtx("http://a.com", "GET", "")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			"Access-Control-Allow-Origin":      "*",
+			"Access-Control-Allow-Methods":     "GET",
+			"Access-Control-Allow-Credentials": "true",
+		})
+
+		ctx = actualCtx("http://a.com")
+		handler(ctx)
+		assertHeaders(t, ctx, map[string]string{
+			"Vary":                             "Origin",
+			"Access-Control-Allow-Origin":      "*",
+			"Access-Control-Allow-Credentials": "true",
+		})
+	}
+}
+
+func TestOriginPoliciesOrder(t *testing.T) {
+	c := New(Options{
+		OriginPolicies: map[string]OriginPolicy{
+			"*":                       {},
+			"https://*.example.com":   {},
+			"https://*.a.example.com": {},
+			"site:example.com":        {},
+			"https://www.example.com": {},
+			"https://b.example.com":   {},
+		},
+	})
+	expected := []string{
+		"https://www.example.com",
+		"https://b.example.com",
+		"https://*.a.example.com",
+		"https://*.example.com",
+		"site:example.com",
+		"*",
+	}
+	if len(c.originPolicies) != len(expected) {
+		t.Fatalf("got %d origin policies, want %d", len(c.originPolicies), len(expected))
+	}
+	for i, p := range c.originPolicies {
+		if p.pattern != expected[i] {
+			t.Errorf("origin policy %d = %q, want %q", i, p.pattern, expected[i])
+		}
+	}
+}
+
+func TestOriginPoliciesValidate(t *testing.T) {
+	options := Options{OriginPolicies: map[string]OriginPolicy{"site:co.uk": {}}}
+	if err := options.Validate(); err == nil {
+		t.Error("Validate should reject a public suffix policy pattern")
+	}
+}
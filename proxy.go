@@ -0,0 +1,271 @@
+package cors
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// trustedProxies holds the networks of the proxies whose forwarded headers are trusted
+type trustedProxies []*net.IPNet
+
+// compileTrustedProxies parses a list of IP addresses and ranges in CIDR notation
+func compileTrustedProxies(proxies []string) (trustedProxies, error) {
+	networks := make(trustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		cidr := proxy
+		if strings.IndexByte(cidr, '/') < 0 {
+			if strings.IndexByte(cidr, ':') < 0 {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("cors: invalid trusted proxy %q: %v", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// trusts checks if the request was received from a trusted proxy
+func (p trustedProxies) trusts(ctx *fasthttp.RequestCtx) bool {
+	return p.containsIP(ctx.RemoteIP())
+}
+
+// ProxyHeaders selects the headers giving the scheme and host of the requests received
+// from TrustedProxies
+type ProxyHeaders int
+
+const (
+	// ProxyXForwarded reads the X-Forwarded-Proto and X-Forwarded-Host headers. When a
+	// header lists several values, only the last one, set by the trusted proxy the
+	// request was received from, is used: the others may come from the client. Behind a
+	// chain of proxies, each trusted proxy must overwrite these headers rather than
+	// append to them. This is the default.
+	ProxyXForwarded ProxyHeaders = iota
+	// ProxyForwarded reads the proto and host parameters of the Forwarded header defined
+	// by RFC 7239, from the element added by the first trusted proxy of the chain.
+	ProxyForwarded
+)
+
+// RequestSchemeHost returns the scheme, http or https, and the host the client sent the
+// request to. When the request comes from one of the TrustedProxies, they are read from
+// the ProxyHeaders, if present. It is the way for AllowOriginRequestFunc to compare the
+// origin with the request, declaring the *Cors before New so the function captures it:
+//
+//	var c *cors.Cors
+//	c = cors.New(cors.Options{
+//	    AllowOriginRequestFunc: func(ctx *fasthttp.RequestCtx, origin []byte) bool {
+//	        scheme, host := c.RequestSchemeHost(ctx)
+//	        return string(origin) == scheme+"://app."+string(host)
+//	    },
+//	})
+func (c *Cors) RequestSchemeHost(ctx *fasthttp.RequestCtx) (string, []byte) {
+	scheme, host := "http", ctx.Host()
+	if ctx.IsTLS() {
+		scheme = "https"
+	}
+	if len(c.trustedProxies) == 0 || !c.trustedProxies.trusts(ctx) {
+		return scheme, host
+	}
+
+	var proto, forwardedHost []byte
+	if c.proxyHeaders == ProxyForwarded {
+		proto, forwardedHost = c.parseForwarded(ctx)
+	} else {
+		proto = lastListValue(ctx.Request.Header.Peek("X-Forwarded-Proto"))
+		forwardedHost = lastListValue(ctx.Request.Header.Peek("X-Forwarded-Host"))
+	}
+	if equalFoldString(proto, "https") {
+		scheme = "https"
+	} else if equalFoldString(proto, "http") {
+		scheme = "http"
+	}
+	if len(forwardedHost) > 0 {
+		host = forwardedHost
+	}
+	return scheme, host
+}
+
+// forwardedElement holds the parameters of an element of a Forwarded header
+type forwardedElement struct {
+	forNode []byte
+	proto   []byte
+	host    []byte
+}
+
+// parseForwarded returns the proto and host parameters of the Forwarded headers of a
+// request. Each proxy appends an element with the address it received the request from
+// as the for parameter, so the element of the first trusted proxy is the last one whose
+// for parameter isn't a trusted proxy. Invalid headers are ignored altogether.
+func (c *Cors) parseForwarded(ctx *fasthttp.RequestCtx) (proto, host []byte) {
+	var selected forwardedElement
+	first, valid := true, true
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		if !valid || !equalFoldString(key, "Forwarded") {
+			return
+		}
+		for {
+			// Skip empty elements
+			for len(value) > 0 && (value[0] == ',' || value[0] == ' ' || value[0] == '\t') {
+				value = value[1:]
+			}
+			if len(value) == 0 {
+				return
+			}
+			var e forwardedElement
+			var ok bool
+			e, value, ok = nextForwardedElement(value)
+			if !ok {
+				valid = false
+				return
+			}
+			if first || !c.trustedProxies.containsNode(e.forNode) {
+				selected = e
+				first = false
+			}
+		}
+	})
+	if !valid {
+		return nil, nil
+	}
+	return selected.proto, selected.host
+}
+
+// nextForwardedElement parses the first element of a non-empty Forwarded header value,
+// returning the rest of the value. Quoted values using escapes aren't supported.
+func nextForwardedElement(value []byte) (e forwardedElement, rest []byte, ok bool) {
+	for {
+		value = trimSpace(value)
+		if len(value) == 0 {
+			return e, nil, true
+		}
+		if value[0] == ',' {
+			return e, value[1:], true
+		}
+		if value[0] == ';' {
+			// Empty pair
+			value = value[1:]
+			continue
+		}
+
+		i := 0
+		for i < len(value) && isTokenChar(value[i]) {
+			i++
+		}
+		if i == 0 || i == len(value) || value[i] != '=' {
+			return e, nil, false
+		}
+		name := value[:i]
+		value = value[i+1:]
+
+		var v []byte
+		if len(value) > 0 && value[0] == '"' {
+			end := 1
+			for end < len(value) && value[end] != '"' {
+				if value[end] == '\\' {
+					return e, nil, false
+				}
+				end++
+			}
+			if end == len(value) {
+				return e, nil, false
+			}
+			v, value = value[1:end], value[end+1:]
+		} else {
+			end := 0
+			for end < len(value) && isTokenChar(value[end]) {
+				end++
+			}
+			if end == 0 {
+				return e, nil, false
+			}
+			v, value = value[:end], value[end:]
+		}
+
+		switch {
+		case equalFoldString(name, "for"):
+			e.forNode = v
+		case equalFoldString(name, "proto"):
+			e.proto = v
+		case equalFoldString(name, "host"):
+			e.host = v
+		}
+
+		value = trimSpace(value)
+		if len(value) > 0 && value[0] != ';' && value[0] != ',' {
+			return e, nil, false
+		}
+		if len(value) > 0 && value[0] == ',' {
+			return e, value[1:], true
+		}
+	}
+}
+
+// containsNode checks if the node of a Forwarded for parameter, an IP address with an
+// optional port, is a trusted proxy. Obfuscated and unknown nodes aren't trusted.
+func (p trustedProxies) containsNode(node []byte) bool {
+	var ip net.IP
+	if len(node) > 0 && node[0] == '[' {
+		end := bytes.IndexByte(node, ']')
+		if end < 0 {
+			return false
+		}
+		if ip = parseIPv6(node[1:end]); ip == nil {
+			return false
+		}
+	} else {
+		if i := bytes.IndexByte(node, ':'); i >= 0 {
+			node = node[:i]
+		}
+		ip4, ok := parseIPv4(node)
+		if !ok {
+			return false
+		}
+		ip = ip4[:]
+	}
+	return p.containsIP(ip)
+}
+
+// containsIP checks if ip belongs to a trusted proxy
+func (p trustedProxies) containsIP(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameOrigin checks if origin is the origin of the request, i.e. the scheme and host
+// the request was sent to, see RequestSchemeHost. Default ports are ignored.
+func (c *Cors) isSameOrigin(ctx *fasthttp.RequestCtx, origin []byte) bool {
+	scheme, host := c.RequestSchemeHost(ctx)
+	port := ":80"
+	if scheme == "https" {
+		port = ":443"
+	}
+	if len(origin) <= len(scheme)+len("://") || !equalFoldString(origin[:len(scheme)], scheme) ||
+		string(origin[len(scheme):len(scheme)+len("://")]) != "://" {
+		return false
+	}
+	if len(host) > len(port) && string(host[len(host)-len(port):]) == port {
+		host = host[:len(host)-len(port)]
+	}
+	return len(host) > 0 && equalFold(origin[len(scheme)+len("://"):], host)
+}
+
+// lastListValue returns the last value of a comma separated header, the one set by the
+// proxy closest to the server
+func lastListValue(value []byte) []byte {
+	if i := bytes.LastIndexByte(value, ','); i >= 0 {
+		value = value[i+1:]
+	}
+	return trimSpace(value)
+}
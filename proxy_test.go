@@ -0,0 +1,225 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestCompileTrustedProxies(t *testing.T) {
+	proxies, err := compileTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"192.0.2.1":   true,
+		"192.0.2.2":   false,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+	}
+	for ip, want := range cases {
+		ctx := remoteCtx("GET", "http://example.com/", ip, nil)
+		if got := proxies.trusts(ctx); got != want {
+			t.Errorf("trusts(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "proxy.local", ""} {
+		if _, err := compileTrustedProxies([]string{invalid}); err == nil {
+			t.Errorf("compileTrustedProxies(%q) should fail", invalid)
+		}
+	}
+	if err := (Options{TrustedProxies: []string{"10.0.0.0/33"}}).Validate(); err == nil {
+		t.Error("Validate should fail on an invalid trusted proxy")
+	}
+}
+
+func TestRequestSchemeHost(t *testing.T) {
+	cases := []struct {
+		name       string
+		remoteIP   string
+		headers    map[string]string
+		wantScheme string
+		wantHost   string
+	}{
+		{"Direct", "203.0.113.1", nil, "http", "backend:8080"},
+		{"Untrusted", "203.0.113.1", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"}, "http", "backend:8080"},
+		{"Trusted", "10.0.0.1", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"}, "https", "example.com"},
+		{"TrustedNoHeaders", "10.0.0.1", nil, "http", "backend:8080"},
+		{"TrustedInvalidProto", "10.0.0.1", map[string]string{"X-Forwarded-Proto": "ftp"}, "http", "backend:8080"},
+		{"TrustedList", "10.0.0.1", map[string]string{"X-Forwarded-Proto": "http, HTTPS ", "X-Forwarded-Host": "evil.com, example.com:8443 "}, "https", "example.com:8443"},
+		{
+			// The values appended by a proxy passing the headers through aren't trusted
+			"TrustedChain",
+			"10.0.0.1",
+			map[string]string{"X-Forwarded-For": "192.0.2.1, 10.0.0.2", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "example.com, backend"},
+			"http", "backend",
+		},
+	}
+	c := New(Options{TrustedProxies: []string{"10.0.0.0/8"}})
+	for _, tc := range cases {
+		ctx := remoteCtx("GET", "http://backend:8080/foo", tc.remoteIP, tc.headers)
+		scheme, host := c.RequestSchemeHost(ctx)
+		if scheme != tc.wantScheme || string(host) != tc.wantHost {
+			t.Errorf("%s: RequestSchemeHost() = %s, %s, want %s, %s", tc.name, scheme, host, tc.wantScheme, tc.wantHost)
+		}
+	}
+}
+
+func TestIsSameOrigin(t *testing.T) {
+	cases := []struct {
+		name     string
+		uri      string
+		remoteIP string
+		headers  map[string]string
+		origin   string
+		want     bool
+	}{
+		{"Same", "http://example.com/foo", "203.0.113.1", nil, "http://example.com", true},
+		{"HostCase", "http://Example.COM/foo", "203.0.113.1", nil, "http://example.com", true},
+		{"DefaultPort", "http://example.com:80/foo", "203.0.113.1", nil, "http://example.com", true},
+		{"Port", "http://example.com:8080/foo", "203.0.113.1", nil, "http://example.com:8080", true},
+		{"OtherPort", "http://example.com:8080/foo", "203.0.113.1", nil, "http://example.com", false},
+		{"ExplicitPort", "http://example.com/foo", "203.0.113.1", nil, "http://example.com:8080", false},
+		{"Scheme", "http://example.com/foo", "203.0.113.1", nil, "https://example.com", false},
+		{"Host", "http://example.com/foo", "203.0.113.1", nil, "http://api.example.com", false},
+		{"Null", "http://example.com/foo", "203.0.113.1", nil, "null", false},
+		{"Malformed", "http://example.com/foo", "203.0.113.1", nil, "http:example.com", false},
+		{
+			"Proxy",
+			"http://backend:8080/foo", "10.0.0.1",
+			map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com:443"},
+			"https://example.com", true,
+		},
+		{
+			"ProxyPort",
+			"http://backend:8080/foo", "10.0.0.1",
+			map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com:8443"},
+			"https://example.com:8443", true,
+		},
+		{
+			"ProxyScheme",
+			"http://example.com/foo", "10.0.0.1",
+			map[string]string{"X-Forwarded-Proto": "https"},
+			"http://example.com", false,
+		},
+		{
+			"UntrustedProxy",
+			"http://backend:8080/foo", "203.0.113.1",
+			map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"},
+			"https://example.com", false,
+		},
+	}
+	c := New(Options{TrustedProxies: []string{"10.0.0.0/8"}})
+	for _, tc := range cases {
+		ctx := remoteCtx("GET", tc.uri, tc.remoteIP, tc.headers)
+		if got := c.isSameOrigin(ctx, []byte(tc.origin)); got != tc.want {
+			t.Errorf("%s: isSameOrigin(%q) = %v, want %v", tc.name, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestRequestSchemeHostForwarded(t *testing.T) {
+	cases := []struct {
+		name       string
+		remoteIP   string
+		forwarded  []string
+		wantScheme string
+		wantHost   string
+	}{
+		{"None", "10.0.0.1", nil, "http", "backend:8080"},
+		{"Untrusted", "203.0.113.1", []string{"for=192.0.2.60;proto=https;host=example.com"}, "http", "backend:8080"},
+		{"Single", "10.0.0.1", []string{"for=192.0.2.60;proto=https;host=example.com"}, "https", "example.com"},
+		{"CaseAndSpaces", "10.0.0.1", []string{" For=192.0.2.60 ; PROTO=HTTPS ; Host=example.com "}, "https", "example.com"},
+		{"QuotedHost", "10.0.0.1", []string{`for="[2001:db8:cafe::17]:4711";proto=https;host="example.com:8443"`}, "https", "example.com:8443"},
+		{
+			"ChainOfTrustedProxies",
+			"10.0.0.1",
+			[]string{"for=192.0.2.60;proto=https;host=example.com, for=10.0.0.2;proto=http;host=internal"},
+			"https", "example.com",
+		},
+		{
+			"ChainInSeveralLines",
+			"10.0.0.1",
+			[]string{"for=192.0.2.60;proto=https;host=example.com", "for=10.0.0.2;proto=http;host=internal"},
+			"https", "example.com",
+		},
+		{
+			"SpoofedByClient",
+			"10.0.0.1",
+			[]string{"for=10.0.0.9;proto=http;host=evil.com, for=192.0.2.60;proto=https;host=example.com"},
+			"https", "example.com",
+		},
+		{
+			"AllTrusted",
+			"10.0.0.1",
+			[]string{"for=10.0.0.3;proto=https;host=example.com, for=10.0.0.2;host=internal"},
+			"https", "example.com",
+		},
+		{"EmptyElements", "10.0.0.1", []string{", ,for=192.0.2.60;proto=https;host=example.com,"}, "https", "example.com"},
+		{"Unknown", "10.0.0.1", []string{"for=unknown;proto=https;host=example.com, for=_hidden;host=internal"}, "http", "internal"},
+		{"Invalid", "10.0.0.1", []string{"for=192.0.2.60;proto=https;host=example.com:8443"}, "http", "backend:8080"},
+		{"Unterminated", "10.0.0.1", []string{`for=192.0.2.60;host="example.com`}, "http", "backend:8080"},
+		{"Escaped", "10.0.0.1", []string{`for=192.0.2.60;host="exa\mple.com"`}, "http", "backend:8080"},
+		{"NoValue", "10.0.0.1", []string{"for=192.0.2.60;proto"}, "http", "backend:8080"},
+	}
+	c := New(Options{TrustedProxies: []string{"10.0.0.0/8"}, ProxyHeaders: ProxyForwarded})
+	for _, tc := range cases {
+		ctx := remoteCtx("GET", "http://backend:8080/foo", tc.remoteIP, map[string]string{
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "x-forwarded.example.com",
+		})
+		for _, value := range tc.forwarded {
+			ctx.Request.Header.Add("Forwarded", value)
+		}
+		scheme, host := c.RequestSchemeHost(ctx)
+		if scheme != tc.wantScheme || string(host) != tc.wantHost {
+			t.Errorf("%s: RequestSchemeHost() = %s, %s, want %s, %s", tc.name, scheme, host, tc.wantScheme, tc.wantHost)
+		}
+	}
+}
+
+func TestForwardedSameOrigin(t *testing.T) {
+	options := Options{
+		AllowOriginRequestFunc: func(ctx *fasthttp.RequestCtx, origin []byte) bool {
+			return false
+		},
+		CSRFGuard:      true,
+		SkipSameOrigin: true,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		ProxyHeaders:   ProxyForwarded,
+	}
+	handler := New(options).Handler(testHandler)
+	ctx := remoteCtx("POST", "http://backend:8080/foo", "10.0.0.1", map[string]string{
+		"Origin":    "https://example.com",
+		"Forwarded": `for=192.0.2.60;proto=https;host=example.com, for="10.0.0.2:5000"`,
+	})
+	handler(ctx)
+	if code := ctx.Response.StatusCode(); code != http.StatusOK {
+		t.Errorf("status = %d, want %d", code, http.StatusOK)
+	}
+	assertHeaders(t, ctx, map[string]string{"Vary": "Origin"})
+}
+
+func TestAllowOriginRequestFuncRequestSchemeHost(t *testing.T) {
+	var c *Cors
+	c = New(Options{
+		AllowOriginRequestFunc: func(ctx *fasthttp.RequestCtx, origin []byte) bool {
+			scheme, host := c.RequestSchemeHost(ctx)
+			return string(origin) == scheme+"://app."+string(host)
+		},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+	ctx := remoteCtx("GET", "http://backend:8080/foo", "10.0.0.1", map[string]string{
+		"Origin":            "https://app.example.com",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "example.com",
+	})
+	c.Handler(testHandler)(ctx)
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                        "Origin",
+		"Access-Control-Allow-Origin": "https://app.example.com",
+	})
+}
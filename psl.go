@@ -0,0 +1,149 @@
+package cors
+
+//go:generate go run ./internal/pslgen -out psl_table.go
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// sitePrefix introduces AllowedOrigins entries matching a whole site
+const sitePrefix = "site:"
+
+// Flags of the Public Suffix List rules, indexed by domain
+const (
+	pslNormal    = 1 << iota // example.com
+	pslWildcard              // *.example.com, indexed as example.com
+	pslException             // !www.example.com
+)
+
+var (
+	pslOnce  sync.Once
+	pslTable map[string]uint8
+)
+
+// publicSuffixes returns the Public Suffix List, parsing it on first use
+func publicSuffixes() map[string]uint8 {
+	pslOnce.Do(func() {
+		rules := strings.Split(strings.TrimSpace(pslRules), "\n")
+		pslTable = make(map[string]uint8, len(rules))
+		for _, rule := range rules {
+			switch {
+			case strings.HasPrefix(rule, "*."):
+				pslTable[rule[2:]] |= pslWildcard
+			case strings.HasPrefix(rule, "!"):
+				pslTable[rule[1:]] |= pslException
+			default:
+				pslTable[rule] |= pslNormal
+			}
+		}
+	})
+	return pslTable
+}
+
+// publicSuffix returns the offset of the public suffix of a lower case host name,
+// following the algorithm of https://publicsuffix.org/list/. Hosts not covered by
+// the list use the implicit "*" rule, their last label being the public suffix.
+func publicSuffix(host []byte) int {
+	table := publicSuffixes()
+	// Walk the suffixes from the longest one, so the first matching rule prevails
+	for i := 0; i < len(host); {
+		suffix := host[i:]
+		flags := table[string(suffix)]
+		dot := bytes.IndexByte(suffix, '.')
+		if flags&pslException != 0 {
+			// An exception's public suffix is the rule minus its leftmost label
+			return i + dot + 1
+		}
+		if flags&pslNormal != 0 || dot >= 0 && table[string(suffix[dot+1:])]&pslWildcard != 0 {
+			return i
+		}
+		if dot < 0 {
+			break
+		}
+		i += dot + 1
+	}
+	return bytes.LastIndexByte(host, '.') + 1
+}
+
+// registrableDomain returns the registrable domain of a lower case host name, the
+// public suffix and one more label, or nil if host is itself a public suffix.
+func registrableDomain(host []byte) []byte {
+	i := publicSuffix(host)
+	if i == 0 {
+		return nil
+	}
+	return host[bytes.LastIndexByte(host[:i-1], '.')+1:]
+}
+
+// siteOrigin matches the origins of a site: a registrable domain and its subdomains
+type siteOrigin struct {
+	strict  bool
+	schemes []string
+	domain  []byte
+}
+
+// SiteOrigin matches the origins of a site, a registrable domain and all its
+// subdomains on any port, i.e. "example.co.uk" matches https://example.co.uk and
+// http://www.example.co.uk:8080, but not https://example.com.co.uk. By default the
+// http and https schemes are matched; the site may start with a scheme to only match
+// that one, i.e. "https://example.co.uk". Registrable domains are determined with a
+// snapshot of the Public Suffix List, so subdomains registered as public suffixes, like
+// the ones of hosting providers, aren't part of the site. An error is returned if site
+// isn't a registrable domain, such as a public suffix (co.uk) or a subdomain
+// (www.example.co.uk).
+func SiteOrigin(site string) (OriginMatcher, error) {
+	return newSiteOrigin(site, false)
+}
+
+// newSiteOrigin parses a site, without the "site:" prefix of AllowedOrigins entries
+func newSiteOrigin(site string, strict bool) (*siteOrigin, error) {
+	m := &siteOrigin{strict: strict, schemes: []string{"http", "https"}}
+	domain := strings.ToLower(site)
+	if i := strings.Index(domain, "://"); i >= 0 {
+		scheme := domain[:i]
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("cors: site %q must use the http or https scheme", site)
+		}
+		m.schemes, domain = []string{scheme}, domain[i+3:]
+	}
+	host := []byte(domain)
+	if _, ok := parseIPv4(host); ok || strings.IndexAny(domain, ":/[]*") >= 0 {
+		return nil, fmt.Errorf("cors: site %q must be a domain name", site)
+	}
+	switch reg := registrableDomain(host); {
+	case reg == nil:
+		return nil, fmt.Errorf("cors: site %q is a public suffix", site)
+	case len(reg) != len(host):
+		return nil, fmt.Errorf("cors: site %q is not a registrable domain, use %q", site, reg)
+	}
+	m.domain = host
+	return m, nil
+}
+
+// Match implements the OriginMatcher interface
+func (m *siteOrigin) Match(origin []byte) bool {
+	scheme, host, _, ok := splitOrigin(origin)
+	if !ok || !m.matchScheme(scheme) || !hasSuffixFold(host, string(m.domain)) {
+		return false
+	}
+	if m.strict || !hasUpper(host) {
+		return bytes.Equal(registrableDomain(host), m.domain)
+	}
+
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+	*buf = appendLower(*buf, host)
+	return bytes.Equal(registrableDomain(*buf), m.domain)
+}
+
+func (m *siteOrigin) matchScheme(scheme []byte) bool {
+	for _, s := range m.schemes {
+		if m.strict && string(scheme) == s || !m.strict && equalFoldString(scheme, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package cors
+
+import (
+	"testing"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	cases := []struct {
+		host, suffix, domain string
+	}{
+		{"com", "com", ""},
+		{"example.com", "com", "example.com"},
+		{"www.example.com", "com", "example.com"},
+		{"co.uk", "co.uk", ""},
+		{"example.co.uk", "co.uk", "example.co.uk"},
+		{"a.b.example.co.uk", "co.uk", "example.co.uk"},
+		// Private section
+		{"github.io", "github.io", ""},
+		{"foo.github.io", "github.io", "foo.github.io"},
+		// Wildcard and exception rules: *.ck and !www.ck
+		{"foo.ck", "foo.ck", ""},
+		{"bar.foo.ck", "foo.ck", "bar.foo.ck"},
+		{"www.ck", "ck", "www.ck"},
+		{"a.www.ck", "ck", "www.ck"},
+		// Internationalized rules are stored as punycode: рф
+		{"xn--p1ai", "xn--p1ai", ""},
+		{"xn--80ak6aa92e.xn--p1ai", "xn--p1ai", "xn--80ak6aa92e.xn--p1ai"},
+		// Implicit * rule
+		{"localhost", "localhost", ""},
+		{"app.localhost", "localhost", "app.localhost"},
+		{"foo.unknowntld", "unknowntld", "foo.unknowntld"},
+	}
+	for _, tc := range cases {
+		host := []byte(tc.host)
+		if got := string(host[publicSuffix(host):]); got != tc.suffix {
+			t.Errorf("publicSuffix(%q) = %q, want %q", tc.host, got, tc.suffix)
+		}
+		if got := string(registrableDomain(host)); got != tc.domain {
+			t.Errorf("registrableDomain(%q) = %q, want %q", tc.host, got, tc.domain)
+		}
+	}
+}
+
+func TestSiteOrigin(t *testing.T) {
+	m, err := SiteOrigin("Example.co.uk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatches(t, "SiteOrigin", m,
+		[]string{"https://example.co.uk", "http://www.example.co.uk:8080", "https://A.B.EXAMPLE.co.uk"},
+		[]string{"https://co.uk", "https://badexample.co.uk", "https://example.co.uk.evil.com", "ftp://example.co.uk", "null"})
+
+	m, err = SiteOrigin("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatches(t, "SiteOrigin https", m,
+		[]string{"https://www.example.com"},
+		[]string{"http://www.example.com"})
+
+	// Subdomains registered as public suffixes belong to other sites
+	m, err = SiteOrigin("amazonaws.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatches(t, "SiteOrigin private suffix", m,
+		[]string{"https://www.amazonaws.com"},
+		[]string{"https://bucket.s3.amazonaws.com"})
+
+	assertMatches(t, "strict siteOrigin", &siteOrigin{strict: true, schemes: []string{"https"}, domain: []byte("example.com")},
+		[]string{"https://www.example.com"},
+		[]string{"https://www.EXAMPLE.com", "HTTPS://www.example.com"})
+}
+
+func TestSiteOriginErrors(t *testing.T) {
+	for _, site := range []string{
+		"co.uk", "com", "github.io", "foo.ck", "www.example.co.uk", "ftp://example.com",
+		"example.com:8080", "*.example.com", "127.0.0.1", "[::1]",
+	} {
+		if _, err := SiteOrigin(site); err == nil {
+			t.Errorf("SiteOrigin(%q) should fail", site)
+		}
+	}
+}
+
+func TestSiteAllowedOrigins(t *testing.T) {
+	c := New(Options{AllowedOrigins: []string{"http://foo.com", "site:example.co.uk"}})
+	assertMatches(t, "AllowedOrigins", c.allowedOrigins,
+		[]string{"http://foo.com", "https://www.example.co.uk"},
+		[]string{"https://other.co.uk"})
+}
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package cors
+
+// raceEnabled is set when the tests run with the race detector, which allocates
+const raceEnabled = true
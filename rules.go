@@ -0,0 +1,139 @@
+package cors
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// RuleAction is the action taken by an OriginRule matching a request
+type RuleAction int
+
+const (
+	// RuleAllow allows the cross-origin requests matching the rule
+	RuleAllow RuleAction = iota
+	// RuleDeny denies the cross-origin requests matching the rule
+	RuleDeny
+)
+
+// OriginRule is an allow or deny rule of Options.OriginRules. A rule matches a request
+// when all its conditions match; empty conditions match any request.
+//
+//	OriginRules: []cors.OriginRule{
+//	    {Name: "legacy", Action: cors.RuleDeny, Origins: []string{"https://legacy.example.com"}},
+//	    {Name: "example", Action: cors.RuleAllow, Origins: []string{"https://*.example.com"}},
+//	}
+type OriginRule struct {
+	// Name identifies the rule in debug logs. Defaults to the rule position.
+	Name string
+	// Action is the action taken when the rule matches. Default is RuleAllow.
+	Action RuleAction
+	// Origins is a list of origin patterns, using the same syntax as AllowedOrigins. As
+	// there, "*" doesn't match the null origin, which must be listed explicitly.
+	Origins []string
+	// PathPrefix restricts the rule to request paths starting with the prefix.
+	PathPrefix string
+	// Methods restricts the rule to some methods. For preflight requests, the requested
+	// method is checked.
+	Methods []string
+	// Hosts restricts the rule to requests sent to some hosts, as given by the Host
+	// header (including the port if any).
+	Hosts []string
+}
+
+// originRule is the compiled version of an OriginRule
+type originRule struct {
+	name    string
+	deny    bool
+	origins OriginMatcher
+	// Set to true when origins is "*", which doesn't match the null origin
+	skipNull   bool
+	pathPrefix []byte
+	methods    []string
+	hosts      [][]byte
+}
+
+// compileOriginRules normalizes a list of rules
+func compileOriginRules(rules []OriginRule, strict bool) []originRule {
+	compiled := make([]originRule, 0, len(rules))
+	for i, rule := range rules {
+		r := originRule{
+			name: rule.Name,
+			deny: rule.Action == RuleDeny,
+		}
+		if r.name == "" {
+			r.name = strconv.Itoa(i)
+		}
+		r.name = "rule " + strconv.Quote(r.name)
+		var all bool
+		r.origins, all = compileOrigins(rule.Origins, strict)
+		r.skipNull = all && !listsNull(rule.Origins)
+		if rule.PathPrefix != "" {
+			r.pathPrefix = []byte(rule.PathPrefix)
+		}
+		for _, m := range rule.Methods {
+			if strict {
+				r.methods = append(r.methods, normalizeMethod(m))
+			} else {
+				r.methods = append(r.methods, strings.ToUpper(m))
+			}
+		}
+		for _, h := range rule.Hosts {
+			r.hosts = append(r.hosts, []byte(strings.ToLower(h)))
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled
+}
+
+// dependsOnRequest checks if some rules have conditions on other parts of the request
+// than the origin and the method
+func dependsOnRequest(rules []originRule) bool {
+	for _, r := range rules {
+		if r.pathPrefix != nil || r.hosts != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks if the rule matches a request
+func (r *originRule) match(ctx *fasthttp.RequestCtx, origin, method []byte, strict bool) bool {
+	if r.origins != nil && !r.origins.Match(origin) {
+		return false
+	}
+	if r.skipNull && string(origin) == "null" {
+		return false
+	}
+	if r.pathPrefix != nil && !bytes.HasPrefix(ctx.Path(), r.pathPrefix) {
+		return false
+	}
+	if r.methods != nil {
+		found := false
+		for _, m := range r.methods {
+			if matchMethod(method, m, strict) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.hosts != nil {
+		host := ctx.Host()
+		found := false
+		for _, h := range r.hosts {
+			if equalFold(h, host) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestOriginRules(t *testing.T) {
+	rules := []OriginRule{
+		{Name: "legacy", Action: RuleDeny, Origins: []string{"https://legacy.example.com"}},
+		{Name: "admin", Action: RuleDeny, PathPrefix: "/admin"},
+		{Name: "internal", Action: RuleAllow, Origins: []string{"https://internal.com"}, Hosts: []string{"api.internal.com"}},
+		{Name: "writes", Action: RuleDeny, Origins: []string{"https://readonly.example.com"}, Methods: []string{"put", "DELETE"}},
+		{Action: RuleAllow, Origins: []string{"https://*.example.com"}},
+	}
+
+	cases := []struct {
+		name     string
+		options  Options
+		origin   string
+		method   string
+		url      string
+		allowed  bool
+		wildcard bool
+		reason   string
+	}{
+		{"AllowedByWildcard", Options{}, "https://www.example.com", "GET", "http://api.com/foo", true, false, `rule "4"`},
+		{"DeniedException", Options{}, "https://legacy.example.com", "GET", "http://api.com/foo", false, false, `rule "legacy"`},
+		{"DeniedPath", Options{}, "https://www.example.com", "GET", "http://api.com/admin/users", false, false, `rule "admin"`},
+		{"AllowedHost", Options{}, "https://internal.com", "GET", "http://API.internal.com/foo", true, false, `rule "internal"`},
+		{"OtherHost", Options{}, "https://internal.com", "GET", "http://api.com/foo", false, false, "AllowedOrigins"},
+		{"DeniedMethod", Options{}, "https://readonly.example.com", "PUT", "http://api.com/foo", false, false, `rule "writes"`},
+		{"AllowedMethod", Options{}, "https://readonly.example.com", "GET", "http://api.com/foo", true, false, `rule "4"`},
+		{"NoMatchDefaultDeny", Options{}, "https://foobar.com", "GET", "http://api.com/foo", false, false, "AllowedOrigins"},
+		{
+			"NoMatchAllowedOrigins",
+			Options{AllowedOrigins: []string{"https://foobar.com"}},
+			"https://foobar.com", "GET", "http://api.com/foo", true, false, "AllowedOrigins",
+		},
+		{
+			"NoMatchAllowedOriginsAll",
+			Options{AllowedOrigins: []string{"*"}},
+			"https://foobar.com", "GET", "http://api.com/foo", true, true, "AllowedOrigins",
+		},
+		{
+			"DeniedOverAllowedOriginsAll",
+			Options{AllowedOrigins: []string{"*"}},
+			"https://legacy.example.com", "GET", "http://api.com/foo", false, false, `rule "legacy"`,
+		},
+		{
+			"NoMatchAllowOriginFunc",
+			Options{AllowOriginFunc: func(origin []byte) bool { return true }},
+			"https://foobar.com", "GET", "http://api.com/foo", true, false, "AllowOriginFunc",
+		},
+	}
+	for i := range cases {
+		tc := cases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			options := tc.options
+			options.OriginRules = rules
+			c := New(options)
+
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod(tc.method)
+			ctx.Request.SetRequestURI(tc.url)
+
+			d := c.checkOrigin(&ctx, []byte(tc.origin), []byte(tc.method))
+			if d.allowed != tc.allowed || d.wildcard != tc.wildcard || d.reason != tc.reason {
+				t.Errorf("checkOrigin = %+v, want {allowed:%v wildcard:%v reason:%s}", d, tc.allowed, tc.wildcard, tc.reason)
+			}
+		})
+	}
+}
+
+func TestOriginRulesNullOrigin(t *testing.T) {
+	never := func(origin []byte) bool { return false }
+	cases := []struct {
+		name    string
+		origins []string
+		allowed bool
+		reason  string
+	}{
+		{"All", []string{"*"}, false, "AllowOriginFunc"},
+		{"AllListed", []string{"*", "null"}, true, `rule "0"`},
+		{"Listed", []string{"null"}, true, `rule "0"`},
+	}
+	for _, tc := range cases {
+		for _, action := range []RuleAction{RuleAllow, RuleDeny} {
+			c := New(Options{AllowOriginFunc: never, OriginRules: []OriginRule{{Action: action, Origins: tc.origins}}})
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod(http.MethodGet)
+			d := c.checkOrigin(&ctx, []byte("null"), []byte(http.MethodGet))
+			allowed := tc.allowed && action == RuleAllow
+			if d.allowed != allowed || d.reason != tc.reason {
+				t.Errorf("%s/%d: checkOrigin(null) = %+v, want {allowed:%v reason:%s}", tc.name, action, d, allowed, tc.reason)
+			}
+		}
+	}
+
+	// Without a custom function, "*" rules don't reach the null origin either
+	ctx := actualCtx("null")
+	New(Options{OriginRules: []OriginRule{{Origins: []string{"*"}}}}).Handler(testHandler)(ctx)
+	assertHeaders(t, ctx, map[string]string{"Vary": "Origin"})
+}
+
+func TestOriginRulesPreflight(t *testing.T) {
+	c := New(Options{
+		AllowedMethods: []string{"GET", "PUT"},
+		OriginRules: []OriginRule{
+			{Action: RuleDeny, Origins: []string{"https://readonly.example.com"}, Methods: []string{"PUT"}},
+			{Action: RuleAllow, Origins: []string{"https://*.example.com"}},
+		},
+	})
+	handler := c.Handler(testHandler)
+
+	ctx := preflightCtx("https://readonly.example.com", "GET", "")
+	handler(ctx)
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		"Access-Control-Allow-Origin":  "https://readonly.example.com",
+		"Access-Control-Allow-Methods": "GET",
+	})
+
+	ctx = preflightCtx("https://readonly.example.com", "PUT", "")
+	handler(ctx)
+	assertHeaders(t, ctx, map[string]string{
+		"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+	})
+}
+
+func TestOriginRulesPreflightCache(t *testing.T) {
+	c := New(Options{
+		OriginRules:        []OriginRule{{Origins: []string{"https://*.example.com"}, Methods: []string{"GET"}}},
+		PreflightCacheSize: 10,
+	})
+	if c.preflightCache == nil {
+		t.Error("preflight cache should be enabled with origin and method conditions")
+	}
+
+	c = New(Options{
+		OriginRules:        []OriginRule{{Origins: []string{"https://*.example.com"}, PathPrefix: "/api"}},
+		PreflightCacheSize: 10,
+	})
+	if c.preflightCache != nil {
+		t.Error("preflight cache should be disabled with path conditions")
+	}
+}
+
+func TestOriginRulesActualRequest(t *testing.T) {
+	handler := New(Options{
+		AllowedOrigins: []string{"*"},
+		OriginRules:    []OriginRule{{Action: RuleDeny, Origins: []string{"https://abuse.com"}}},
+	}).Handler(testHandler)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(http.MethodGet)
+	ctx.Request.SetRequestURI("http://example.com/foo")
+	ctx.Request.Header.Add("Origin", "https://abuse.com")
+	handler(&ctx)
+	assertHeaders(t, &ctx, map[string]string{
+		"Vary": "Origin",
+	})
+
+	ctx.Response.Reset()
+	ctx.Request.Header.Set("Origin", "https://foobar.com")
+	handler(&ctx)
+	assertHeaders(t, &ctx, map[string]string{
+		"Vary":                        "Origin",
+		"Access-Control-Allow-Origin": "*",
+	})
+}
@@ -0,0 +1,88 @@
+package cors
+
+import (
+	"net"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ErrorHandler wraps a fasthttp.Server ErrorHandler so the error responses sent when a
+// request can't be read, such as a body too large or a read timeout, carry the CORS
+// headers of the request when its Origin is available. A nil h uses the default error
+// responses of fasthttp.
+func (c *Cors) ErrorHandler(h func(ctx *fasthttp.RequestCtx, err error)) func(ctx *fasthttp.RequestCtx, err error) {
+	if h == nil {
+		h = defaultErrorHandler
+	}
+	return func(ctx *fasthttp.RequestCtx, err error) {
+		h(ctx, err)
+		c.writeErrorHeaders(ctx, &ctx.Response.Header)
+	}
+}
+
+// WrapServer wraps the ErrorHandler of s with Cors.ErrorHandler. It must be called
+// before the server starts.
+func (c *Cors) WrapServer(s *fasthttp.Server) {
+	s.ErrorHandler = c.ErrorHandler(s.ErrorHandler)
+}
+
+// TimeoutHandler is fasthttp.TimeoutHandler writing the CORS headers of the request to
+// its 408 Request Timeout responses.
+func (c *Cors) TimeoutHandler(h fasthttp.RequestHandler, timeout time.Duration, msg string) fasthttp.RequestHandler {
+	return c.TimeoutWithCodeHandler(h, timeout, msg, fasthttp.StatusRequestTimeout)
+}
+
+// TimeoutWithCodeHandler wraps fasthttp.TimeoutWithCodeHandler, writing the CORS headers
+// of the request to its timeout responses, and to its 429 Too Many Requests responses
+// when Server.Concurrency handlers are already running. As with fasthttp, the handler
+// keeps running after the timeout, so it must not retain ctx.
+func (c *Cors) TimeoutWithCodeHandler(h fasthttp.RequestHandler, timeout time.Duration, msg string, statusCode int) fasthttp.RequestHandler {
+	if timeout <= 0 {
+		return h
+	}
+	timeoutHandler := fasthttp.TimeoutWithCodeHandler(h, timeout, msg, statusCode)
+	return func(ctx *fasthttp.RequestCtx) {
+		// The timeout response is rendered before running h, as the request can't be
+		// read while h runs
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		resp.SetStatusCode(statusCode)
+		resp.SetBodyString(msg)
+		c.writeErrorHeaders(ctx, &resp.Header)
+
+		timeoutHandler(ctx)
+		if ctx.LastTimeoutErrorResponse() != nil {
+			ctx.TimeoutErrorWithResponse(resp)
+		} else if ctx.Response.StatusCode() == fasthttp.StatusTooManyRequests {
+			c.writeErrorHeaders(ctx, &ctx.Response.Header)
+		}
+	}
+}
+
+// writeErrorHeaders writes the CORS headers of the request of ctx to the headers of an
+// error response, keeping the CORS headers already present. Preflight headers are only
+// written when the response doesn't have an Access-Control-Allow-Origin yet.
+func (c *Cors) writeErrorHeaders(ctx *fasthttp.RequestCtx, headers *fasthttp.ResponseHeader) {
+	if ctx.IsOptions() && len(ctx.Request.Header.Peek("Access-Control-Request-Method")) != 0 {
+		if len(headers.Peek("Access-Control-Allow-Origin")) > 0 {
+			return
+		}
+		c.logf("Error response: Preflight request")
+		addVary(headers, c.preflightVary(c.writePreflight(ctx, headers)))
+		return
+	}
+	c.logf("Error response: Actual request")
+	c.writeActualRequest(ctx, headers, true)
+}
+
+// defaultErrorHandler replies like the default fasthttp.Server ErrorHandler
+func defaultErrorHandler(ctx *fasthttp.RequestCtx, err error) {
+	if _, ok := err.(*fasthttp.ErrSmallBuffer); ok {
+		ctx.Error("Too big request header", fasthttp.StatusRequestHeaderFieldsTooLarge)
+	} else if netErr, ok := err.(*net.OpError); ok && netErr.Timeout() {
+		ctx.Error("Request timeout", fasthttp.StatusRequestTimeout)
+	} else {
+		ctx.Error("Error when parsing request", fasthttp.StatusBadRequest)
+	}
+}
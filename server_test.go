@@ -0,0 +1,204 @@
+package cors
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// serve sends a raw request to s and returns the response
+func serve(t *testing.T, s *fasthttp.Server, request string) *fasthttp.Response {
+	t.Helper()
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go s.Serve(ln) //nolint:errcheck
+
+	conn, err := ln.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp fasthttp.Response
+	if err := resp.Read(bufio.NewReader(conn)); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func TestErrorHandler(t *testing.T) {
+	c := New(Options{AllowedOrigins: []string{"http://foobar.com"}, AllowCredentials: true})
+	s := &fasthttp.Server{
+		Handler:            c.Handler(testHandler),
+		MaxRequestBodySize: 10,
+		Logger:             &testLogger{},
+	}
+	c.WrapServer(s)
+
+	body := strings.Repeat("x", 100)
+	resp := serve(t, s, "POST /foo HTTP/1.1\r\nHost: example.com\r\nOrigin: http://foobar.com\r\n"+
+		"Content-Length: 100\r\n\r\n"+body)
+	if resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode(), http.StatusBadRequest)
+	}
+	for name, value := range map[string]string{
+		"Vary":                             "Origin",
+		"Access-Control-Allow-Origin":      "http://foobar.com",
+		"Access-Control-Allow-Credentials": "true",
+	} {
+		if got := string(resp.Header.Peek(name)); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestErrorHandlerCustom(t *testing.T) {
+	c := New(Options{AllowedOrigins: []string{"http://foobar.com"}})
+	h := c.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		ctx.Error(err.Error(), http.StatusRequestEntityTooLarge)
+		ctx.Response.Header.Set("Access-Control-Allow-Origin", "http://mine.com")
+	})
+
+	ctx := actualCtx("http://foobar.com")
+	h(ctx, fasthttp.ErrBodyTooLarge)
+	if ctx.Response.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), http.StatusRequestEntityTooLarge)
+	}
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                        "Origin",
+		"Access-Control-Allow-Origin": "http://mine.com",
+	})
+
+	ctx = preflightCtx("http://foobar.com", "GET", "")
+	h(ctx, fasthttp.ErrBodyTooLarge)
+	assertHeaders(t, ctx, map[string]string{
+		"Access-Control-Allow-Origin": "http://mine.com",
+	})
+
+	ctx = preflightCtx("http://foobar.com", "GET", "")
+	c.ErrorHandler(nil)(ctx, fasthttp.ErrBodyTooLarge)
+	if ctx.Response.StatusCode() != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", ctx.Response.StatusCode(), http.StatusBadRequest)
+	}
+	assertHeaders(t, ctx, map[string]string{
+		"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		"Access-Control-Allow-Origin":  "http://foobar.com",
+		"Access-Control-Allow-Methods": "GET",
+	})
+}
+
+func TestTimeoutHandler(t *testing.T) {
+	c := New(Options{AllowedOrigins: []string{"http://foobar.com"}, ExposedHeaders: []string{"X-Header"}})
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(ctx *fasthttp.RequestCtx) {
+		<-release
+	}
+	s := &fasthttp.Server{Handler: c.Handler(c.TimeoutHandler(slow, 10*time.Millisecond, "too slow"))}
+
+	resp := serve(t, s, "GET /foo HTTP/1.1\r\nHost: example.com\r\nOrigin: http://foobar.com\r\n\r\n")
+	if resp.StatusCode() != http.StatusRequestTimeout || string(resp.Body()) != "too slow" {
+		t.Errorf("response = %d %q, want %d %q", resp.StatusCode(), resp.Body(), http.StatusRequestTimeout, "too slow")
+	}
+	for name, value := range map[string]string{
+		"Vary":                          "Origin",
+		"Access-Control-Allow-Origin":   "http://foobar.com",
+		"Access-Control-Expose-Headers": "X-Header",
+	} {
+		if got := string(resp.Header.Peek(name)); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestTimeoutHandlerInTime(t *testing.T) {
+	c := New(Options{})
+	s := &fasthttp.Server{Handler: c.TimeoutHandler(testHandler, time.Second, "too slow")}
+	resp := serve(t, s, "GET /foo HTTP/1.1\r\nHost: example.com\r\nOrigin: http://foobar.com\r\n\r\n")
+	if got := string(resp.Body()); got != "bar" {
+		t.Errorf("body = %q, want %q", got, "bar")
+	}
+	if c.TimeoutHandler(nil, 0, "") != nil {
+		t.Error("TimeoutHandler should return the handler when the timeout is disabled")
+	}
+}
+
+func TestTimeoutHandlerRunning(t *testing.T) {
+	c := New(Options{AllowedOrigins: []string{"http://foobar.com"}, ExposedHeaders: []string{"X-Header"}})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	slow := func(ctx *fasthttp.RequestCtx) {
+		defer close(finished)
+		// Keeps reading the request while the timeout response is sent
+		for {
+			select {
+			case <-release:
+				return
+			default:
+				ctx.Request.Header.Peek("Origin")
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	s := &fasthttp.Server{Handler: c.Handler(c.TimeoutHandler(slow, 10*time.Millisecond, "too slow"))}
+
+	resp := serve(t, s, "GET /foo HTTP/1.1\r\nHost: example.com\r\nOrigin: http://foobar.com\r\n\r\n")
+	close(release)
+	<-finished
+	if resp.StatusCode() != http.StatusRequestTimeout {
+		t.Errorf("status = %d, want %d", resp.StatusCode(), http.StatusRequestTimeout)
+	}
+	if got := string(resp.Header.Peek("Access-Control-Allow-Origin")); got != "http://foobar.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, "http://foobar.com")
+	}
+}
+
+func TestTimeoutHandlerConcurrency(t *testing.T) {
+	c := New(Options{AllowedOrigins: []string{"http://foobar.com"}})
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(ctx *fasthttp.RequestCtx) {
+		<-release
+	}
+	s := &fasthttp.Server{Handler: c.TimeoutHandler(slow, 10*time.Millisecond, "too slow"), Concurrency: 1}
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go s.Serve(ln) //nolint:errcheck
+
+	// The first handler keeps running after its timeout, so the second request is
+	// rejected with 429 Too Many Requests
+	for i, want := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests} {
+		conn, err := ln.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := "GET /foo HTTP/1.1\r\nHost: example.com\r\nOrigin: http://foobar.com\r\nConnection: close\r\n\r\n"
+		if _, err := conn.Write([]byte(request)); err != nil {
+			t.Fatal(err)
+		}
+		var resp fasthttp.Response
+		if err := resp.Read(bufio.NewReader(conn)); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if resp.StatusCode() != want || string(resp.Body()) != "too slow" {
+			t.Errorf("request %d: response = %d %q, want %d %q", i, resp.StatusCode(), resp.Body(), want, "too slow")
+		}
+		for name, value := range map[string]string{
+			"Vary":                        "Origin",
+			"Access-Control-Allow-Origin": "http://foobar.com",
+		} {
+			if got := string(resp.Header.Peek(name)); got != value {
+				t.Errorf("request %d: %s = %q, want %q", i, name, got, value)
+			}
+		}
+	}
+}
@@ -2,6 +2,9 @@ package cors
 
 import (
 	"bytes"
+	"errors"
+	"strings"
+	"sync"
 )
 
 const toLower = 'a' - 'A'
@@ -17,6 +20,49 @@ func (w wildcard) match(s []byte) bool {
 	return len(s) >= len(w.prefix)+len(w.suffix) && bytes.HasPrefix(s, w.prefix) && bytes.HasSuffix(s, w.suffix)
 }
 
+// matchFold is the ASCII case-insensitive version of match. It expects a lower case
+// wildcard.
+func (w wildcard) matchFold(s []byte) bool {
+	return len(s) >= len(w.prefix)+len(w.suffix) &&
+		equalFold(s[:len(w.prefix)], w.prefix) &&
+		equalFold(s[len(s)-len(w.suffix):], w.suffix)
+}
+
+// lower returns the ASCII lower case of b
+func lower(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + toLower
+	}
+	return b
+}
+
+// equalFold reports whether a and b are equal under ASCII case-folding. Unlike
+// bytes.EqualFold, it neither allocates nor applies Unicode folding.
+func equalFold(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && lower(a[i]) != lower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFoldString is equalFold for a string without converting it
+func equalFoldString(a []byte, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && lower(a[i]) != lower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // convert converts a list of string using the passed converter function
 func convert(s []string, c converter) []string {
 	out := []string{}
@@ -26,48 +72,223 @@ func convert(s []string, c converter) []string {
 	return out
 }
 
-// parseHeaderList tokenize + normalize a string containing a list of headers
-func parseHeaderList(headerList []byte) []string {
-	l := len(headerList)
-	h := make([]byte, 0, l)
-	upper := true
-	// Estimate the number headers in order to allocate the right splice size
-	t := 0
-	for i := 0; i < l; i++ {
-		if headerList[i] == ',' {
-			t++
+// normalizedMethods lists the methods the Fetch spec normalizes to upper case,
+// see https://fetch.spec.whatwg.org/#concept-method-normalize
+var normalizedMethods = []string{"DELETE", "GET", "HEAD", "OPTIONS", "POST", "PUT"}
+
+// isNormalizedMethod checks if method is, case-insensitively, one of the methods
+// normalized by the Fetch spec
+func isNormalizedMethod(method []byte) bool {
+	for _, m := range normalizedMethods {
+		if equalFoldString(method, m) {
+			return true
 		}
 	}
-	headers := make([]string, 0, t)
-	for i := 0; i < l; i++ {
-		b := headerList[i]
+	return false
+}
+
+// normalizeMethod upper-cases method only if it is normalized by the Fetch spec
+func normalizeMethod(method string) string {
+	if isNormalizedMethod([]byte(method)) {
+		return strings.ToUpper(method)
+	}
+	return method
+}
+
+// matchMethod checks if a request method matches a normalized method. Unless strict is
+// set, methods are compared case-insensitively. In strict mode, only the methods
+// normalized by the Fetch spec are compared case-insensitively.
+func matchMethod(method []byte, normalized string, strict bool) bool {
+	if !strict || isNormalizedMethod(method) {
+		return equalFoldString(method, normalized)
+	}
+	return string(method) == normalized
+}
+
+// isOriginValid checks that origin is a serialized origin as defined by RFC 6454:
+// either "null" or a lower case scheme "://" host [ ":" port ] without any path,
+// query, fragment or user information.
+func isOriginValid(origin []byte) bool {
+	if string(origin) == "null" {
+		return true
+	}
+
+	i := bytes.Index(origin, []byte("://"))
+	if i <= 0 {
+		return false
+	}
+	scheme, host := origin[:i], origin[i+3:]
+
+	for j, b := range scheme {
 		switch {
 		case b >= 'a' && b <= 'z':
-			if upper {
-				h = append(h, b-toLower)
-			} else {
-				h = append(h, b)
+		case j > 0 && (b >= '0' && b <= '9' || b == '+' || b == '-' || b == '.'):
+		default:
+			return false
+		}
+	}
+
+	if len(host) > 0 && host[0] == '[' {
+		// IPv6 literal
+		end := bytes.IndexByte(host, ']')
+		if end < 0 {
+			return false
+		}
+		for _, b := range host[1:end] {
+			if !(b >= '0' && b <= '9' || b >= 'a' && b <= 'f' || b == ':' || b == '.') {
+				return false
 			}
-		case b >= 'A' && b <= 'Z':
-			if !upper {
-				h = append(h, b+toLower)
-			} else {
-				h = append(h, b)
+		}
+		host = host[end+1:]
+		if len(host) > 0 && host[0] != ':' {
+			return false
+		}
+	} else {
+		n := 0
+		for n < len(host) && host[n] != ':' {
+			b := host[n]
+			if !(b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-' || b == '.' || b == '_' || b == '~') {
+				return false
 			}
-		case b == '-' || b == '_' || b == '.' || (b >= '0' && b <= '9'):
-			h = append(h, b)
+			n++
+		}
+		if n == 0 {
+			return false
 		}
+		host = host[n:]
+	}
 
-		if b == ' ' || b == ',' || i == l-1 {
-			if len(h) > 0 {
-				// Flush the found header
-				headers = append(headers, string(h))
-				h = h[:0]
-				upper = true
+	// Optional port
+	if len(host) > 0 {
+		port := host[1:]
+		if len(port) == 0 || len(port) > 5 {
+			return false
+		}
+		for _, b := range port {
+			if b < '0' || b > '9' {
+				return false
 			}
-		} else {
-			upper = b == '-' || b == '_'
 		}
 	}
-	return headers
+	return true
+}
+
+const (
+	// maxRequestHeaders caps the number of headers accepted in Access-Control-Request-Headers
+	maxRequestHeaders = 100
+	// maxRequestHeadersLength caps the combined length of Access-Control-Request-Headers
+	maxRequestHeadersLength = 8192
+)
+
+var (
+	errInvalidHeaderList = errors.New("cors: invalid header name in Access-Control-Request-Headers")
+	errTooManyHeaders    = errors.New("cors: too many headers in Access-Control-Request-Headers")
+	errHeaderListTooLong = errors.New("cors: Access-Control-Request-Headers is too long")
+	errHeaderNotAllowed  = errors.New("cors: header not allowed")
+
+	errPrivateNetworkCredentials = errors.New("cors: AllowLoopback and AllowedOriginCIDRs can't be combined with AllowCredentials in strict mode unless AllowPrivateNetworkCredentials is set")
+	errPreflightSuccessStatus    = errors.New("cors: PreflightSuccessStatus must be a 2xx status")
+	errPreflightFailureStatus    = errors.New("cors: PreflightFailureStatus must be a 2xx, 3xx, 4xx or 5xx status")
+	errIsolationSameOrigin       = errors.New("cors: Isolation can't use Cross-Origin-Resource-Policy same-origin, it blocks the resources loaded by the allowed origins")
+)
+
+// tokenChars flags the tchar bytes defined by RFC 7230 section 3.2.6
+var tokenChars = [256]bool{}
+
+func init() {
+	for b := 'a'; b <= 'z'; b++ {
+		tokenChars[b] = true
+		tokenChars[b-toLower] = true
+	}
+	for b := '0'; b <= '9'; b++ {
+		tokenChars[b] = true
+	}
+	for _, b := range []byte("!#$%&'*+-.^_`|~") {
+		tokenChars[b] = true
+	}
+}
+
+// isTokenChar checks if b is a tchar as defined by RFC 7230 section 3.2.6
+func isTokenChar(b byte) bool {
+	return tokenChars[b]
+}
+
+// appendCanonicalHeaderKey appends the canonical format of a valid header token to dst,
+// the same way http.CanonicalHeaderKey does: the first letter and any letter following
+// a hyphen are upper case, the rest is lower case.
+func appendCanonicalHeaderKey(dst, token []byte) []byte {
+	upper := true
+	for _, b := range token {
+		if upper && b >= 'a' && b <= 'z' {
+			b -= toLower
+		} else if !upper && b >= 'A' && b <= 'Z' {
+			b += toLower
+		}
+		dst = append(dst, b)
+		upper = b == '-'
+	}
+	return dst
+}
+
+// appendUpper appends the ASCII upper case of b to dst
+func appendUpper(dst, b []byte) []byte {
+	for _, c := range b {
+		if c >= 'a' && c <= 'z' {
+			c -= toLower
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// nextHeaderToken returns the next token of a comma separated list of header names
+// as defined by RFC 7230 (1#field-name, with optional whitespace and empty list
+// elements), starting at position i, along with the position following it. A nil token
+// is returned at the end of the list, and an error as soon as an invalid token is found.
+func nextHeaderToken(headerList []byte, i int) ([]byte, int, error) {
+	l := len(headerList)
+	for i < l {
+		// Skip optional whitespace and empty list elements
+		if b := headerList[i]; b == ' ' || b == '\t' || b == ',' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < l && isTokenChar(headerList[i]) {
+			i++
+		}
+		if i == start {
+			return nil, i, errInvalidHeaderList
+		}
+		token := headerList[start:i]
+
+		// A token may only be followed by optional whitespace and a comma
+		for i < l && (headerList[i] == ' ' || headerList[i] == '\t') {
+			i++
+		}
+		if i < l && headerList[i] != ',' {
+			return nil, i, errInvalidHeaderList
+		}
+		return token, i, nil
+	}
+	return nil, l, nil
+}
+
+// bufferPool recycles the buffers used to render header values
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// acquireBuffer returns an empty buffer from the pool
+func acquireBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// releaseBuffer returns a buffer to the pool
+func releaseBuffer(buf *[]byte) {
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
 }
@@ -1,6 +1,7 @@
 package cors
 
 import (
+	"net/http"
 	"strings"
 	"testing"
 )
@@ -23,6 +24,34 @@ func TestWildcard(t *testing.T) {
 	}
 }
 
+func TestWildcardMatchFold(t *testing.T) {
+	w := wildcard{[]byte("http://"), []byte(".bar.com")}
+	if !w.matchFold([]byte("HTTP://Foo.BAR.com")) {
+		t.Error("http://*.bar.com should match HTTP://Foo.BAR.com")
+	}
+	if w.matchFold([]byte("http://foo.baz.com")) {
+		t.Error("http://*.bar.com should not match http://foo.baz.com")
+	}
+	if w.matchFold([]byte("http://.bar.co")) {
+		t.Error("http://*.bar.com should not match http://.bar.co")
+	}
+}
+
+func TestEqualFold(t *testing.T) {
+	if !equalFold([]byte("Http://Foo.com"), []byte("http://foo.COM")) {
+		t.Error("Http://Foo.com should equal http://foo.COM")
+	}
+	if equalFold([]byte("http://foo.com"), []byte("http://foo.co")) {
+		t.Error("http://foo.com should not equal http://foo.co")
+	}
+	if equalFold([]byte("a["), []byte("A{")) {
+		t.Error("a[ should not equal A{")
+	}
+	if !equalFoldString([]byte("options"), "OPTIONS") {
+		t.Error("options should equal OPTIONS")
+	}
+}
+
 func TestConvert(t *testing.T) {
 	s := convert([]string{"A", "b", "C"}, strings.ToLower)
 	e := []string{"a", "b", "c"}
@@ -31,44 +60,211 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+func TestIsOriginValid(t *testing.T) {
+	valid := []string{
+		"null",
+		"http://foo.com",
+		"https://foo.com:8443",
+		"http://127.0.0.1:3000",
+		"http://[::1]:8080",
+		"chrome-extension://abcdefghijklmnop",
+		"capacitor://localhost",
+	}
+	for _, o := range valid {
+		if !isOriginValid([]byte(o)) {
+			t.Errorf("%q should be a valid origin", o)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"foo.com",
+		"Null",
+		"HTTP://foo.com",
+		"http://Foo.com",
+		"http://",
+		"http://foo.com/",
+		"http://foo.com/path",
+		"http://foo.com?q",
+		"http://user@foo.com",
+		"http://foo.com:",
+		"http://foo.com:123456",
+		"http://foo.com:8o",
+		"http://[::1",
+		"http://[::1]x",
+		"1http://foo.com",
+	}
+	for _, o := range invalid {
+		if isOriginValid([]byte(o)) {
+			t.Errorf("%q should be an invalid origin", o)
+		}
+	}
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	cases := map[string]string{
+		"get":      "GET",
+		"Delete":   "DELETE",
+		"patch":    "patch",
+		"PATCH":    "PATCH",
+		"propfind": "propfind",
+	}
+	for in, want := range cases {
+		if got := normalizeMethod(in); got != want {
+			t.Errorf("normalizeMethod(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// requestHeaders parses list as the Access-Control-Request-Headers of a preflight, the
+// way the handler does, and returns the canonical headers it holds
+func requestHeaders(list string) ([]string, error) {
+	p := &policy{allowedHeadersAll: true}
+	dst, _, err := p.appendRequestHeaders(nil, preflightCtx("http://foo.com", "GET", list))
+	if len(dst) == 0 {
+		return nil, err
+	}
+	return strings.Split(string(dst), ", "), err
+}
+
+// requestHeadersSeeds are the seed corpus of FuzzRequestHeaders, also checked by
+// TestRequestHeadersSeeds on Go versions without fuzzing
+var requestHeadersSeeds = []string{
+	"",
+	" , ",
+	"header, second-header, THIRD-HEADER",
+	"X-Foo@Bar",
+	"\tx-foo ,,  x_bar\t",
+	"a b",
+	"!#$%&'*+-.^_`|~",
+	"\xff, X-Foo",
+}
+
+// checkRequestHeaders checks the invariants of the parsing of list
+func checkRequestHeaders(t *testing.T, list string) {
+	headers, err := requestHeaders(list)
+	if err != nil {
+		return
+	}
+	if len(headers) > maxRequestHeaders {
+		t.Fatalf("got %d headers, more than %d", len(headers), maxRequestHeaders)
+	}
+
+	// Every parsed header must be exactly one of the non-empty elements of the list, in
+	// order, modulo case
+	var elements []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.Trim(e, " \t"); e != "" {
+			elements = append(elements, e)
+		}
+	}
+	if len(elements) != len(headers) {
+		t.Fatalf("requestHeaders(%q) = %q, want %d headers", list, headers, len(elements))
+	}
+	for i, h := range headers {
+		if !strings.EqualFold(h, elements[i]) {
+			t.Fatalf("requestHeaders(%q)[%d] = %q, want %q", list, i, h, elements[i])
+		}
+		if h != http.CanonicalHeaderKey(h) {
+			t.Fatalf("requestHeaders(%q)[%d] = %q is not canonical", list, i, h)
+		}
+	}
+
+	// Parsing must be stable
+	again, err := requestHeaders(strings.Join(headers, ", "))
+	if err != nil || strings.Join(again, ",") != strings.Join(headers, ",") {
+		t.Fatalf("re-parsing %q = %q, %v", headers, again, err)
+	}
+}
+
+func TestRequestHeadersSeeds(t *testing.T) {
+	for _, seed := range requestHeadersSeeds {
+		checkRequestHeaders(t, seed)
+	}
+}
+
 func TestParseHeaderList(t *testing.T) {
-	h := parseHeaderList([]byte("header, second-header, THIRD-HEADER, Numb3r3d-H34d3r"))
+	h, err := requestHeaders("header, second-header, THIRD-HEADER, Numb3r3d-H34d3r")
 	e := []string{"Header", "Second-Header", "Third-Header", "Numb3r3d-H34d3r"}
-	if h[0] != e[0] || h[1] != e[1] || h[2] != e[2] {
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != len(e) || h[0] != e[0] || h[1] != e[1] || h[2] != e[2] || h[3] != e[3] {
+		t.Errorf("%v != %v", h, e)
+	}
+}
+
+func TestParseHeaderListWhitespace(t *testing.T) {
+	h, err := requestHeaders("\tx-foo ,,  x_bar\t,, ,")
+	e := []string{"X-Foo", "X_bar"}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != len(e) || h[0] != e[0] || h[1] != e[1] {
 		t.Errorf("%v != %v", h, e)
 	}
 }
 
 func TestParseHeaderListEmpty(t *testing.T) {
-	if len(parseHeaderList(nil)) != 0 {
+	if h, err := requestHeaders(""); len(h) != 0 || err != nil {
 		t.Error("should be empty slice")
 	}
-	if len(parseHeaderList([]byte(" , "))) != 0 {
+	if h, err := requestHeaders(" , "); len(h) != 0 || err != nil {
 		t.Error("should be empty slice")
 	}
 }
 
-func BenchmarkParseHeaderList(b *testing.B) {
-	b.ReportAllocs()
-	for i := 0; i < b.N; i++ {
-		parseHeaderList([]byte("header, second-header, THIRD-HEADER"))
+func TestParseHeaderListInvalid(t *testing.T) {
+	for _, l := range []string{
+		"X-Foo@Bar",
+		"X-Foo Bar",
+		"X-Foo, Bar;",
+		"X-Foo\r\n, Bar",
+		"\"X-Foo\"",
+		"X-Fóo",
+	} {
+		if h, err := requestHeaders(l); err != errInvalidHeaderList {
+			t.Errorf("requestHeaders(%q) = %v, %v, want error", l, h, err)
+		}
 	}
 }
 
-func BenchmarkParseHeaderListSingle(b *testing.B) {
-	b.ReportAllocs()
-	for i := 0; i < b.N; i++ {
-		parseHeaderList([]byte("header"))
+func TestParseHeaderListLimits(t *testing.T) {
+	list := strings.Repeat("a,", maxRequestHeaders) + "b"
+	if _, err := requestHeaders(list); err != errTooManyHeaders {
+		t.Errorf("got %v, want %v", err, errTooManyHeaders)
+	}
+
+	list = strings.Repeat("a", maxRequestHeadersLength+1)
+	if _, err := requestHeaders(list); err != errHeaderListTooLong {
+		t.Errorf("got %v, want %v", err, errHeaderListTooLong)
 	}
 }
 
-func BenchmarkParseHeaderListNormalized(b *testing.B) {
+// benchmarkRequestHeaders measures the parsing of list, reusing the request and buffer
+func benchmarkRequestHeaders(b *testing.B, list string) {
+	p := &policy{allowedHeadersAll: true}
+	ctx := preflightCtx("http://foo.com", "GET", list)
+	var dst []byte
 	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		parseHeaderList([]byte("Header1, Header2, Third-Header"))
+		dst, _, _ = p.appendRequestHeaders(dst[:0], ctx)
 	}
 }
 
+func BenchmarkParseHeaderList(b *testing.B) {
+	benchmarkRequestHeaders(b, "header, second-header, THIRD-HEADER")
+}
+
+func BenchmarkParseHeaderListSingle(b *testing.B) {
+	benchmarkRequestHeaders(b, "header")
+}
+
+func BenchmarkParseHeaderListNormalized(b *testing.B) {
+	benchmarkRequestHeaders(b, "Header1, Header2, Third-Header")
+}
+
 func BenchmarkWildcard(b *testing.B) {
 	w := wildcard{[]byte("foo"), []byte("bar")}
 	b.Run("match", func(b *testing.B) {
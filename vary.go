@@ -0,0 +1,89 @@
+package cors
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+// Values merged into the Vary header of responses
+var (
+	varyOrigin    = []byte("Origin")
+	varyPreflight = []byte("Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	// Preflight responses allowing all origins with "*" don't depend on Origin
+	varyPreflightAnyOrigin = []byte("Access-Control-Request-Method, Access-Control-Request-Headers")
+)
+
+// addVary merges names, a comma separated list of header names, into the Vary header
+// of a response. The existing values are kept, names already listed are skipped
+// ignoring case, and the result is written as a single header line. A response
+// varying on "*" is left untouched, as it already varies on everything.
+func addVary(headers *fasthttp.ResponseHeader, names []byte) {
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	lines, merged := 0, false
+	headers.VisitAll(func(key, value []byte) {
+		if !equalFoldString(key, "Vary") {
+			return
+		}
+		lines++
+		before := len(*buf)
+		if !appendVary(buf, value) {
+			// Keep values we can't parse as they are
+			*buf = (*buf)[:before]
+			if value = trimSpace(value); len(value) > 0 {
+				if before > 0 {
+					*buf = append(*buf, ", "...)
+				}
+				*buf = append(*buf, value...)
+			}
+		} else if len(*buf)-before < len(trimSpace(value)) {
+			merged = true
+		}
+	})
+	if headerListContains(*buf, headerWildcard) {
+		return
+	}
+
+	existing := len(*buf)
+	appendVary(buf, names)
+	if len(*buf) == existing && lines <= 1 && !merged {
+		return
+	}
+	if lines > 0 {
+		headers.Del("Vary")
+	}
+	headers.SetBytesV("Vary", *buf)
+}
+
+// appendVary appends the names of a comma separated list to the Vary values of buf,
+// skipping the ones already listed. It reports whether the list could be parsed.
+func appendVary(buf *[]byte, list []byte) bool {
+	for i := 0; ; {
+		name, next, err := nextHeaderToken(list, i)
+		if err != nil {
+			return false
+		}
+		if name == nil {
+			return true
+		}
+		i = next
+		if headerListContains(*buf, name) {
+			continue
+		}
+		if len(*buf) > 0 {
+			*buf = append(*buf, ", "...)
+		}
+		*buf = append(*buf, name...)
+	}
+}
+
+// trimSpace removes the leading and trailing spaces and tabs of b
+func trimSpace(b []byte) []byte {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
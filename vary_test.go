@@ -0,0 +1,103 @@
+package cors
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestAddVary(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing []string
+		names    string
+		want     []string
+	}{
+		{"Empty", nil, "Origin", []string{"Origin"}},
+		{"List", nil, "Origin, Access-Control-Request-Method", []string{"Origin, Access-Control-Request-Method"}},
+		{"Merge", []string{"Accept-Encoding"}, "Origin", []string{"Accept-Encoding, Origin"}},
+		{"MergeLines", []string{"Accept-Encoding", " Accept-Language ", ""}, "Origin", []string{"Accept-Encoding, Accept-Language, Origin"}},
+		{"Dedupe", []string{"accept-encoding, ORIGIN"}, "Origin", []string{"accept-encoding, ORIGIN"}},
+		{"DedupeLines", []string{"Origin", "Accept-Encoding"}, "Origin", []string{"Origin, Accept-Encoding"}},
+		{"DedupeList", []string{"Origin"}, "Origin, Access-Control-Request-Method", []string{"Origin, Access-Control-Request-Method"}},
+		{"Wildcard", []string{"*"}, "Origin", []string{"*"}},
+		{"WildcardList", []string{"Accept-Encoding, *"}, "Origin", []string{"Accept-Encoding, *"}},
+	}
+	for _, tc := range cases {
+		var h fasthttp.ResponseHeader
+		for _, v := range tc.existing {
+			h.Add("Vary", v)
+		}
+		addVary(&h, []byte(tc.names))
+
+		var got []string
+		h.VisitAll(func(key, value []byte) {
+			if string(key) == "Vary" {
+				got = append(got, string(value))
+			}
+		})
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: Vary = %q, want %q", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: Vary = %q, want %q", tc.name, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestVaryMergedWithHandler(t *testing.T) {
+	handler := New(Options{
+		AllowedOrigins:      []string{"http://foobar.com"},
+		ReapplyAfterHandler: true,
+	}).Handler(func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Add("Vary", "Accept-Encoding")
+		ctx.Response.Header.Add("Vary", "origin")
+	})
+
+	ctx := actualCtx("http://foobar.com")
+	ctx.Response.Header.Add("Vary", "Cookie")
+	handler(ctx)
+	if got := headerValues(ctx, "Vary"); len(got) != 1 || got[0] != "Cookie, Origin, Accept-Encoding" {
+		t.Errorf("Vary = %q, want a single %q", got, "Cookie, Origin, Accept-Encoding")
+	}
+
+	ctx = preflightCtx("http://foobar.com", "GET", "")
+	ctx.Response.Header.Add("Vary", "Accept-Encoding")
+	handler(ctx)
+	want := "Accept-Encoding, Origin, Access-Control-Request-Method, Access-Control-Request-Headers"
+	if got := headerValues(ctx, "Vary"); len(got) != 1 || got[0] != want {
+		t.Errorf("Vary = %q, want a single %q", got, want)
+	}
+}
+
+func TestVaryAnyOrigin(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		vary    bool
+	}{
+		{"Default", Options{}, false},
+		{"AllowedOriginsAll", Options{AllowedOrigins: []string{"*"}}, false},
+		{"Credentials", Options{AllowCredentials: true}, true},
+		{"DeniedOrigins", Options{DeniedOrigins: []string{"http://evil.com"}}, true},
+		{"AllowOriginFunc", Options{AllowOriginFunc: func(o []byte) bool { return true }}, true},
+		{"AllowedOrigins", Options{AllowedOrigins: []string{"http://foobar.com"}}, true},
+	}
+	for _, tc := range cases {
+		handler := New(tc.options).Handler(testHandler)
+		for _, ctx := range []*fasthttp.RequestCtx{actualCtx("http://foobar.com"), preflightCtx("http://foobar.com", "GET", "")} {
+			handler(ctx)
+			if got := headerListContains([]byte(joinHeaderValues(ctx, "Vary")), varyOrigin); got != tc.vary {
+				t.Errorf("%s %s: Vary contains Origin = %v, want %v", tc.name, ctx.Method(), got, tc.vary)
+			}
+		}
+	}
+
+	// Rejected origins still vary
+	ctx := actualCtx("null")
+	New(Options{}).Handler(testHandler)(ctx)
+	assertHeaders(t, ctx, map[string]string{"Vary": "Origin"})
+}